@@ -0,0 +1,228 @@
+package latitude
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Budget is a monthly spend limit enforced on server creation. Limits are
+// compared with the projected monthly cost of the servers, see MonthlyCost.
+type Budget struct {
+	// Currency the limits are expressed in, defaults to USD
+	Currency PricingCurrency
+
+	// Team is the limit for every project of the team, zero means no limit
+	Team float64
+
+	// Projects are per project limits, keyed by the project id or slug used
+	// in ServerCreateAttributes.Project
+	Projects map[string]float64
+}
+
+// BudgetExceededError is returned by ServerService.Create when creating the
+// server would take the projected monthly spend over the budget
+type BudgetExceededError struct {
+	// Scope is "team" or "project", and Project the project the limit applies to
+	Scope     string
+	Project   string
+	Currency  PricingCurrency
+	Limit     float64
+	Current   float64
+	Projected float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	scope := e.Scope
+	if e.Project != "" {
+		scope = fmt.Sprintf("%s %s", e.Scope, e.Project)
+	}
+	return fmt.Sprintf("creating the server would raise the %s monthly spend from %.2f to %.2f %s, over the budget of %.2f %s",
+		scope, e.Current, e.Projected, e.Currency, e.Limit, e.Currency)
+}
+
+// BudgetUnpricedError is returned by ServerService.Create when the budget
+// can't be checked because the new server or an existing one has no known
+// price in the budget currency
+type BudgetUnpricedError struct {
+	Currency  PricingCurrency
+	Hostnames []string
+}
+
+func (e *BudgetUnpricedError) Error() string {
+	return fmt.Sprintf("can't check the budget, no %s price is known for %s", e.Currency, strings.Join(e.Hostnames, ", "))
+}
+
+// budgetGuard checks server creation against the client budget. Servers
+// being created are reserved until their creation returns, so concurrent
+// creates such as BulkCreate can't overrun the budget together. Spend is
+// fetched without holding mu, and the creates that finish meanwhile are kept
+// as settled costs until no check that started before them is running.
+type budgetGuard struct {
+	client *Client
+
+	mu       sync.Mutex
+	budget   *Budget
+	reserved map[string]float64
+	seq      uint64
+	settled  []settledCost
+	checking map[uint64]int
+}
+
+// settledCost is the cost of a create that returned, seq orders it against
+// the checks in flight
+type settledCost struct {
+	seq     uint64
+	project string
+	cost    float64
+}
+
+// SetBudget enables the budget guardrail on server creation, or disables it
+// when b is nil. A create request can bypass it with BudgetOverride.
+func (c *Client) SetBudget(b *Budget) {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+	c.budget.budget = b
+}
+
+// reserve checks that the server fits in the budget and reserves its cost.
+// The returned release func must be called once the create call returns,
+// reporting whether the server was created.
+func (g *budgetGuard) reserve(req *ServerCreateRequest) (func(created bool), error) {
+	noop := func(bool) {}
+	project := req.Data.Attributes.Project
+
+	g.mu.Lock()
+	b := g.budget
+	if b == nil {
+		g.mu.Unlock()
+		return noop, nil
+	}
+	projectLimit, hasProjectLimit := b.Projects[project]
+	if b.Team == 0 && !hasProjectLimit {
+		g.mu.Unlock()
+		return noop, nil
+	}
+	start := g.seq
+	if g.checking == nil {
+		g.checking = map[uint64]int{}
+	}
+	g.checking[start]++
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.checking[start]--; g.checking[start] == 0 {
+			delete(g.checking, start)
+		}
+		g.prune()
+	}()
+
+	currency := b.Currency
+	if currency == "" {
+		currency = CurrencyUSD
+	}
+	plans, _, err := g.client.Plans.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := EstimateCost(plans, []ServerCreateRequest{*req}, currency)
+	if err != nil {
+		return nil, err
+	}
+	cost := estimate.Total()
+
+	// an unpriced server would count as zero spend and let creates past
+	// the budget
+	unpriced := estimate.Unpriced()
+	var projectSpend, teamSpend float64
+	if hasProjectLimit {
+		servers, _, err := g.client.Servers.List(project, nil)
+		if err != nil {
+			return nil, err
+		}
+		spend := ServerCost(plans, servers, currency)
+		projectSpend = spend.Total()
+		unpriced = append(unpriced, spend.Unpriced()...)
+	}
+	if b.Team > 0 {
+		spend, err := NewCostCalculator(g.client, currency).TeamSpend()
+		if err != nil {
+			return nil, err
+		}
+		teamSpend = spend.Total()
+		unpriced = append(unpriced, spend.Unpriced()...)
+	}
+	if len(unpriced) > 0 {
+		return nil, &BudgetUnpricedError{Currency: currency, Hostnames: unpriced}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// creates that returned since the spend was fetched may be missing from it
+	var settledProject, settledTeam float64
+	for _, sc := range g.settled {
+		if sc.seq > start {
+			settledTeam += sc.cost
+			if sc.project == project {
+				settledProject += sc.cost
+			}
+		}
+	}
+
+	if hasProjectLimit {
+		current := projectSpend + g.reserved[project] + settledProject
+		if current+cost > projectLimit {
+			return nil, &BudgetExceededError{Scope: "project", Project: project, Currency: currency, Limit: projectLimit, Current: current, Projected: current + cost}
+		}
+	}
+
+	if b.Team > 0 {
+		current := teamSpend + settledTeam
+		for _, r := range g.reserved {
+			current += r
+		}
+		if current+cost > b.Team {
+			return nil, &BudgetExceededError{Scope: "team", Currency: currency, Limit: b.Team, Current: current, Projected: current + cost}
+		}
+	}
+
+	if g.reserved == nil {
+		g.reserved = map[string]float64{}
+	}
+	g.reserved[project] += cost
+	return func(created bool) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.reserved[project] -= cost
+		if created {
+			g.seq++
+			g.settled = append(g.settled, settledCost{seq: g.seq, project: project, cost: cost})
+			g.prune()
+		}
+	}, nil
+}
+
+// prune drops the settled costs no running check started before. It must be
+// called with mu held.
+func (g *budgetGuard) prune() {
+	if len(g.checking) == 0 {
+		g.settled = nil
+		return
+	}
+	oldest := g.seq
+	for start := range g.checking {
+		if start < oldest {
+			oldest = start
+		}
+	}
+	kept := g.settled[:0]
+	for _, sc := range g.settled {
+		if sc.seq > oldest {
+			kept = append(kept, sc)
+		}
+	}
+	g.settled = kept
+}
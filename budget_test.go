@@ -0,0 +1,155 @@
+package latitude
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testBudgetPlans = `{"data":[{"id":"plan_1","type":"plans","attributes":{"slug":"c2-small-x86","specs":{"memory":{"total":32}},"regions":[{"name":"Brazil","locations":{"available":["SAO"],"in_stock":["SAO"]},"pricing":{"USD":{"hour":0.22,"month":153.0,"year":1349.0}}}]}}]}`
+
+func TestServerCreateBudget(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	creates := 0
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /plans":
+			fmt.Fprint(w, testBudgetPlans)
+		case "GET /projects":
+			fmt.Fprint(w, `{"data":[{"id":"proj_1","type":"projects","attributes":{"name":"shop"}}]}`)
+		case "GET /servers":
+			fmt.Fprint(w, `{"data":[{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","plan":{"slug":"c2-small-x86","billing":"monthly"},"region":{"site":{"slug":"SAO"}}}}]}`)
+		case "POST /servers":
+			creates++
+			fmt.Fprint(w, `{"data":{"id":"sv_2","type":"servers","attributes":{"hostname":"web-2"}}}`)
+		case "GET /servers/sv_2":
+			fmt.Fprint(w, `{"data":{"id":"sv_2","type":"servers","attributes":{"status":"on"}}}`)
+		}
+	})
+
+	scr := ServerCreateRequest{
+		Data: ServerCreateData{
+			Type:       testServerType,
+			Attributes: ServerCreateAttributes{Project: "proj_1", Plan: "c2-small-x86", Site: "SAO", Hostname: "web-2", Billing: "monthly"},
+		},
+	}
+
+	c.SetBudget(&Budget{Projects: map[string]float64{"proj_1": 400}})
+	if _, _, err := c.Servers.Create(&scr); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetBudget(&Budget{Projects: map[string]float64{"proj_1": 200}})
+	_, _, err := c.Servers.Create(&scr)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("expected a BudgetExceededError, got %v", err)
+	}
+	assertEqual(t, budgetErr.Scope, "project", "Budget scope")
+	assertEqual(t, budgetErr.Current, 153.0, "Current spend")
+	assertEqual(t, budgetErr.Projected, 306.0, "Projected spend")
+
+	c.SetBudget(&Budget{Team: 300})
+	if _, _, err := c.Servers.Create(&scr); !errors.As(err, &budgetErr) || budgetErr.Scope != "team" {
+		t.Fatalf("expected a team BudgetExceededError, got %v", err)
+	}
+
+	scr.BudgetOverride = true
+	if _, _, err := c.Servers.Create(&scr); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, creates, 2, "Servers created")
+}
+
+func TestServerCreateBudgetUnpriced(t *testing.T) {
+	creates := 0
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /plans":
+			fmt.Fprint(w, testBudgetPlans)
+		case "GET /servers":
+			// no BRL price is known for web-1, its cost would read as zero
+			fmt.Fprint(w, `{"data":[{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","plan":{"slug":"c2-small-x86","billing":"monthly"},"region":{"site":{"slug":"SAO"}}}}]}`)
+		case "POST /servers":
+			creates++
+		}
+	})
+
+	scr := ServerCreateRequest{
+		Data: ServerCreateData{
+			Type:       testServerType,
+			Attributes: ServerCreateAttributes{Project: "proj_1", Plan: "c2-small-x86", Site: "SAO", Hostname: "web-2", Billing: "monthly"},
+		},
+	}
+	c.SetBudget(&Budget{Currency: CurrencyBRL, Projects: map[string]float64{"proj_1": 400}})
+	_, _, err := c.Servers.Create(&scr)
+	var unpricedErr *BudgetUnpricedError
+	if !errors.As(err, &unpricedErr) {
+		t.Fatalf("expected a BudgetUnpricedError, got %v", err)
+	}
+	assertEqual(t, fmt.Sprint(unpricedErr.Hostnames), "[web-2 web-1]", "Unpriced servers")
+	assertEqual(t, creates, 0, "Servers created")
+}
+
+func TestServerCreateBudgetConcurrent(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	var fetching, maxFetching, creates int32
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /plans":
+			n := atomic.AddInt32(&fetching, 1)
+			defer atomic.AddInt32(&fetching, -1)
+			for {
+				m := atomic.LoadInt32(&maxFetching)
+				if n <= m || atomic.CompareAndSwapInt32(&maxFetching, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(w, testBudgetPlans)
+		case "GET /servers":
+			// the listing doesn't show servers created by the test
+			fmt.Fprint(w, `{"data":[{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","plan":{"slug":"c2-small-x86","billing":"monthly"},"region":{"site":{"slug":"SAO"}}}}]}`)
+		case "POST /servers":
+			atomic.AddInt32(&creates, 1)
+			fmt.Fprint(w, `{"data":{"id":"sv_2","type":"servers","attributes":{"hostname":"web-2"}}}`)
+		case "GET /servers/sv_2":
+			fmt.Fprint(w, `{"data":{"id":"sv_2","type":"servers","attributes":{"status":"on"}}}`)
+		}
+	})
+
+	template := ServerCreateRequest{
+		Data: ServerCreateData{
+			Type:       testServerType,
+			Attributes: ServerCreateAttributes{Project: "proj_1", Plan: "c2-small-x86", Site: "SAO", Billing: "monthly"},
+		},
+	}
+	reqs, err := NewBulkCreateRequests(template, 3, "web-%d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for a single new server
+	c.SetBudget(&Budget{Projects: map[string]float64{"proj_1": 400}})
+	results, _ := c.Servers.BulkCreate(reqs, &BulkCreateOptions{Concurrency: 3})
+	if atomic.LoadInt32(&maxFetching) < 2 {
+		t.Fatal("expected the budget checks to fetch the spend concurrently")
+	}
+	assertEqual(t, atomic.LoadInt32(&creates), int32(1), "Servers created")
+	assertEqual(t, len(results.Succeeded()), 1, "Succeeded creates")
+	for _, r := range results.Failed() {
+		var budgetErr *BudgetExceededError
+		if !errors.As(r.Err, &budgetErr) {
+			t.Fatalf("expected a BudgetExceededError, got %v", r.Err)
+		}
+	}
+}
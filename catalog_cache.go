@@ -0,0 +1,190 @@
+package latitude
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultCatalogTTL = time.Hour
+
+// CatalogKind is a catalog endpoint whose unfiltered list can be cached
+type CatalogKind string
+
+const (
+	CatalogPlans            CatalogKind = "plans"
+	CatalogRegions          CatalogKind = "regions"
+	CatalogOperatingSystems CatalogKind = "operating_systems"
+	CatalogRoles            CatalogKind = "roles"
+)
+
+// CatalogCacheOptions configures the catalog cache
+type CatalogCacheOptions struct {
+	// TTL is how long a fetched list is served from the cache, defaults to
+	// one hour
+	TTL time.Duration
+
+	// Path, if set, is a file the cache is loaded from when enabled and saved
+	// to after every fetch, so separate processes start warm
+	Path string
+}
+
+// catalogCache caches the unfiltered lists of the catalog endpoints. Lists
+// are kept as JSON so every caller gets its own copy, and concurrent misses
+// on the same kind share a single fetch.
+type catalogCache struct {
+	mu      sync.Mutex
+	enabled bool
+	ttl     time.Duration
+	path    string
+	entries map[CatalogKind]catalogEntry
+	calls   map[CatalogKind]*catalogCall
+}
+
+type catalogEntry struct {
+	Data      json.RawMessage `json:"data"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+// catalogCall is a fetch in flight that concurrent misses wait on
+type catalogCall struct {
+	done chan struct{}
+	data json.RawMessage
+	resp *Response
+	err  error
+}
+
+// EnableCatalogCache caches the unfiltered List of plans, regions, operating
+// systems and roles. Filtered lists always reach the API, and lists served
+// from the cache return a nil *Response.
+func (c *Client) EnableCatalogCache(opts CatalogCacheOptions) error {
+	cc := c.catalog
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.enabled = true
+	cc.ttl = opts.TTL
+	if cc.ttl <= 0 {
+		cc.ttl = defaultCatalogTTL
+	}
+	cc.path = opts.Path
+	cc.entries = map[CatalogKind]catalogEntry{}
+	if cc.path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(cc.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &cc.entries)
+}
+
+// DisableCatalogCache stops caching and drops the cached lists. The cache
+// file, if any, is left untouched.
+func (c *Client) DisableCatalogCache() {
+	cc := c.catalog
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.enabled = false
+	cc.entries = nil
+}
+
+// InvalidateCatalog drops the cached lists of the given kinds, or of every
+// kind when none is given, so the next List fetches them again
+func (c *Client) InvalidateCatalog(kinds ...CatalogKind) error {
+	cc := c.catalog
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if len(kinds) == 0 {
+		cc.entries = map[CatalogKind]catalogEntry{}
+	}
+	for _, k := range kinds {
+		delete(cc.entries, k)
+	}
+	return cc.save()
+}
+
+func (cc *catalogCache) isEnabled() bool {
+	if cc == nil {
+		return false
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.enabled
+}
+
+// save writes the entries to the cache file. It must be called with mu held.
+func (cc *catalogCache) save() error {
+	if cc.path == "" || !cc.enabled {
+		return nil
+	}
+	b, err := json.Marshal(cc.entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cc.path, b)
+}
+
+// get returns the cached list of the kind, fetching it when missing or
+// expired. Only one fetch per kind runs at a time.
+func (cc *catalogCache) get(kind CatalogKind, fetch func() (json.RawMessage, *Response, error)) (json.RawMessage, *Response, error) {
+	cc.mu.Lock()
+	if e, ok := cc.entries[kind]; ok && time.Since(e.FetchedAt) < cc.ttl {
+		cc.mu.Unlock()
+		return e.Data, nil, nil
+	}
+	if call, ok := cc.calls[kind]; ok {
+		cc.mu.Unlock()
+		<-call.done
+		return call.data, call.resp, call.err
+	}
+	call := &catalogCall{done: make(chan struct{})}
+	if cc.calls == nil {
+		cc.calls = map[CatalogKind]*catalogCall{}
+	}
+	cc.calls[kind] = call
+	cc.mu.Unlock()
+
+	call.data, call.resp, call.err = fetch()
+
+	cc.mu.Lock()
+	delete(cc.calls, kind)
+	if call.err == nil && cc.enabled {
+		cc.entries[kind] = catalogEntry{Data: call.data, FetchedAt: time.Now()}
+		// the cache file is best effort, a failed save only means the next
+		// process starts cold
+		_ = cc.save()
+	}
+	cc.mu.Unlock()
+	close(call.done)
+
+	return call.data, call.resp, call.err
+}
+
+// catalogList serves the list of the kind through the cache
+func catalogList[T any](cc *catalogCache, kind CatalogKind, fetch func() ([]T, *Response, error)) ([]T, *Response, error) {
+	data, resp, err := cc.get(kind, func() (json.RawMessage, *Response, error) {
+		items, resp, err := fetch()
+		if err != nil {
+			return nil, resp, err
+		}
+		data, err := json.Marshal(items)
+		return data, resp, err
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, resp, err
+	}
+	return items, resp, nil
+}
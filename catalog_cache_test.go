@@ -0,0 +1,78 @@
+package latitude
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCatalogCache(t *testing.T) {
+	var fetches int32
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		// keep the fetch in flight long enough for concurrent lists to join it
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, testBudgetPlans)
+	})
+	cachePath := filepath.Join(t.TempDir(), "catalog.json")
+	if err := c.EnableCatalogCache(CatalogCacheOptions{TTL: time.Hour, Path: cachePath}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plans, _, err := c.Plans.List(nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			assertEqual(t, plans[0].Specs.Memory.Total, "32", "Plan memory")
+		}()
+	}
+	wg.Wait()
+	assertEqual(t, atomic.LoadInt32(&fetches), int32(1), "Concurrent fetches")
+
+	// callers get their own copy of the cached list
+	plans, resp, err := c.Plans.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, resp == nil, true, "Cached response")
+	plans[0].Slug = "changed"
+	plans, _, _ = c.Plans.List(nil)
+	assertEqual(t, plans[0].Slug, "c2-small-x86", "Cached plan slug")
+
+	// filtered lists bypass the cache
+	if _, _, err := c.Plans.List(&ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, atomic.LoadInt32(&fetches), int32(2), "Fetches after filtered list")
+
+	if err := c.InvalidateCatalog(CatalogPlans); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Plans.List(nil); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, atomic.LoadInt32(&fetches), int32(3), "Fetches after invalidation")
+
+	// a new client starts warm from the cache file
+	warm := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	})
+	if err := warm.EnableCatalogCache(CatalogCacheOptions{Path: cachePath}); err != nil {
+		t.Fatal(err)
+	}
+	plans, _, err = warm.Plans.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, plans[0].Regions[0].PlanPricing.USD.Month, 153.0, "Persisted plan price")
+}
@@ -0,0 +1,144 @@
+package latitude
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// conditionalMaxEntries bounds the remembered responses, the least recently
+// used one is dropped to make room for a new one
+const conditionalMaxEntries = 256
+
+// ErrNotModifiedWithoutBody is returned when the API answers 304 Not Modified
+// to a request whose previous response isn't remembered, so there is no body
+// to decode
+var ErrNotModifiedWithoutBody = errors.New("304 Not Modified without a remembered response")
+
+// conditionalCache remembers the validators and body of GET responses per
+// URL, to revalidate them with conditional requests
+type conditionalCache struct {
+	mu      sync.Mutex
+	enabled bool
+	entries map[string]conditionalEntry
+	uses    uint64
+}
+
+type conditionalEntry struct {
+	etag         string
+	lastModified string
+	body         []byte
+	// used orders the entries by their last use, for eviction
+	used uint64
+}
+
+// EnableConditionalRequests makes GET requests send If-None-Match and
+// If-Modified-Since for URLs whose previous response carried an ETag or
+// Last-Modified header. When the API answers 304 Not Modified, the previous
+// body is decoded instead and Response.FromCache is set. Up to 256 responses
+// are remembered, the least recently used ones are dropped first.
+func (c *Client) EnableConditionalRequests() {
+	c.conditional.mu.Lock()
+	defer c.conditional.mu.Unlock()
+	c.conditional.enabled = true
+	if c.conditional.entries == nil {
+		c.conditional.entries = map[string]conditionalEntry{}
+	}
+}
+
+// DisableConditionalRequests stops sending conditional requests and drops the
+// remembered responses
+func (c *Client) DisableConditionalRequests() {
+	c.conditional.mu.Lock()
+	defer c.conditional.mu.Unlock()
+	c.conditional.enabled = false
+	c.conditional.entries = nil
+}
+
+// lookup returns the remembered response for the request, if conditional
+// requests are enabled and the request is a GET
+func (cc *conditionalCache) lookup(req *http.Request) (conditionalEntry, bool) {
+	if cc == nil || req.Method != http.MethodGet {
+		return conditionalEntry{}, false
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if !cc.enabled {
+		return conditionalEntry{}, false
+	}
+	key := req.URL.String()
+	e, ok := cc.entries[key]
+	if ok {
+		cc.uses++
+		e.used = cc.uses
+		cc.entries[key] = e
+	}
+	return e, ok
+}
+
+// prepare adds the conditional headers of the remembered response to req
+func (cc *conditionalCache) prepare(req *http.Request) {
+	e, ok := cc.lookup(req)
+	if !ok {
+		return
+	}
+	if e.etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", e.etag)
+	}
+	if e.lastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", e.lastModified)
+	}
+}
+
+// wants reports whether the response to req should be remembered
+func (cc *conditionalCache) wants(req *http.Request, resp *http.Response) bool {
+	if cc == nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.enabled
+}
+
+func (cc *conditionalCache) store(req *http.Request, resp *http.Response, body []byte) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if !cc.enabled {
+		return
+	}
+	key := req.URL.String()
+	if _, ok := cc.entries[key]; !ok && len(cc.entries) >= conditionalMaxEntries {
+		cc.evict()
+	}
+	cc.uses++
+	cc.entries[key] = conditionalEntry{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		body:         body,
+		used:         cc.uses,
+	}
+}
+
+// evict drops the least recently used entry, the caller holds cc.mu
+func (cc *conditionalCache) evict() {
+	var oldest string
+	var oldestUse uint64
+	for key, e := range cc.entries {
+		if oldest == "" || e.used < oldestUse {
+			oldest, oldestUse = key, e.used
+		}
+	}
+	delete(cc.entries, oldest)
+}
+
+// unconditional returns a copy of the GET request without the conditional
+// headers, to fetch a full response when a 304 can't be served from cc
+func unconditional(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	return r
+}
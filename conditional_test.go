@@ -0,0 +1,105 @@
+package latitude
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	etag := `"v1"`
+	hostname := "web-1"
+	requests := 0
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":%q}}}`, hostname)
+	})
+
+	// without conditional requests every response is fresh
+	_, resp, err := c.Servers.Get("sv_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, resp, err = c.Servers.Get("sv_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, resp.FromCache, false, "Response from cache")
+
+	c.EnableConditionalRequests()
+	if _, _, err := c.Servers.Get("sv_1", nil); err != nil {
+		t.Fatal(err)
+	}
+	server, resp, err := c.Servers.Get("sv_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, resp.FromCache, true, "Response from cache")
+	assertEqual(t, resp.StatusCode, http.StatusNotModified, "Response status")
+	assertEqual(t, server.Hostname, "web-1", "Cached hostname")
+
+	etag, hostname = `"v2"`, "web-2"
+	server, resp, err = c.Servers.Get("sv_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, resp.FromCache, false, "Response from cache")
+	assertEqual(t, server.Hostname, "web-2", "Updated hostname")
+	assertEqual(t, requests, 5, "Requests")
+}
+
+func TestConditionalNotModifiedWithoutEntry(t *testing.T) {
+	requests := 0
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1"}}}`)
+	})
+	c.EnableConditionalRequests()
+
+	// the caller's validators don't match a remembered response, the request
+	// is sent again without them
+	res := new(ServerGetResponse)
+	resp, err := c.DoRequestWithHeader("GET", map[string]string{"If-None-Match": `"v0"`}, serverBasePath+"/sv_1", nil, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, resp.StatusCode, http.StatusOK, "Response status")
+	assertEqual(t, res.Data.Attributes.Hostname, "web-1", "Hostname")
+	assertEqual(t, requests, 2, "Requests")
+}
+
+func TestConditionalCacheEviction(t *testing.T) {
+	cc := &conditionalCache{enabled: true, entries: map[string]conditionalEntry{}}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}}
+	get := func(i int) *http.Request {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.example/servers/sv_%d", i), nil)
+		return req
+	}
+
+	for i := 0; i < conditionalMaxEntries; i++ {
+		cc.store(get(i), resp, nil)
+	}
+	// sv_0 is used again, sv_1 becomes the least recently used entry
+	if _, ok := cc.lookup(get(0)); !ok {
+		t.Fatal("expected sv_0 to be remembered")
+	}
+	cc.store(get(conditionalMaxEntries), resp, nil)
+
+	assertEqual(t, len(cc.entries), conditionalMaxEntries, "Remembered responses")
+	if _, ok := cc.lookup(get(1)); ok {
+		t.Fatal("expected sv_1 to be evicted")
+	}
+	if _, ok := cc.lookup(get(0)); !ok {
+		t.Fatal("expected sv_0 to be kept")
+	}
+}
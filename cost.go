@@ -0,0 +1,294 @@
+package latitude
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hoursPerMonth is the average number of hours in a month used to project
+// hourly billing to a monthly cost
+const hoursPerMonth = 730
+
+// MonthlyCost normalizes a price for a billing period to a monthly cost
+func MonthlyCost(price float64, billing BillingType) float64 {
+	switch billing {
+	case BillingMonthly:
+		return price
+	case BillingYearly:
+		return price / 12
+	}
+	return price * hoursPerMonth
+}
+
+// CostLine is the cost of a single server, existing or proposed
+type CostLine struct {
+	Project  string
+	Hostname string
+	Plan     string
+	Site     string
+	Region   string
+	Tags     []string
+	Billing  BillingType
+
+	// Price is the price for the billing period and Monthly its projection
+	// to a month, both in the report currency
+	Price   float64
+	Monthly float64
+
+	// Estimated is set when the price comes from the plan pricing rather than
+	// from the price the API reports for the server
+	Estimated bool
+
+	// Unpriced is set when no price is known for the server in the report
+	// currency. Price and Monthly are zero, so the totals leave it out.
+	Unpriced bool
+}
+
+// CostReport is a set of server costs in a single currency
+type CostReport struct {
+	Currency PricingCurrency
+	Lines    []CostLine
+}
+
+// Unpriced returns the hostnames of the lines without a known price, whose
+// cost is missing from the totals
+func (r *CostReport) Unpriced() []string {
+	var hostnames []string
+	for _, l := range r.Lines {
+		if l.Unpriced {
+			hostnames = append(hostnames, l.Hostname)
+		}
+	}
+	return hostnames
+}
+
+// Total returns the projected monthly cost of every priced line
+func (r *CostReport) Total() float64 {
+	total := 0.0
+	for _, l := range r.Lines {
+		total += l.Monthly
+	}
+	return total
+}
+
+// ByProject returns the projected monthly cost per project
+func (r *CostReport) ByProject() map[string]float64 {
+	return r.groupBy(func(l CostLine) []string { return []string{l.Project} })
+}
+
+// ByRegion returns the projected monthly cost per region
+func (r *CostReport) ByRegion() map[string]float64 {
+	return r.groupBy(func(l CostLine) []string { return []string{l.Region} })
+}
+
+// ByTag returns the projected monthly cost per tag. A server with several
+// tags counts towards each of them, and untagged servers are grouped under "".
+func (r *CostReport) ByTag() map[string]float64 {
+	return r.groupBy(func(l CostLine) []string {
+		if len(l.Tags) == 0 {
+			return []string{""}
+		}
+		return l.Tags
+	})
+}
+
+func (r *CostReport) groupBy(keys func(CostLine) []string) map[string]float64 {
+	groups := map[string]float64{}
+	for _, l := range r.Lines {
+		for _, k := range keys(l) {
+			groups[k] += l.Monthly
+		}
+	}
+	return groups
+}
+
+// WriteCSV writes one row per line, with a header row
+func (r *CostReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"project", "hostname", "plan", "site", "region", "tags", "billing", "currency", "price", "monthly", "estimated", "unpriced"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, l := range r.Lines {
+		row := []string{
+			l.Project,
+			l.Hostname,
+			l.Plan,
+			l.Site,
+			l.Region,
+			strings.Join(l.Tags, ";"),
+			string(l.Billing),
+			string(r.Currency),
+			strconv.FormatFloat(l.Price, 'f', 2, 64),
+			strconv.FormatFloat(l.Monthly, 'f', 2, 64),
+			strconv.FormatBool(l.Estimated),
+			strconv.FormatBool(l.Unpriced),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// planRegionForSite returns the region of a plan that offers the site
+func planRegionForSite(p Plan, site string) (PlanRegion, bool) {
+	for _, region := range p.Regions {
+		if containsFold(region.Locations.Available, site) {
+			return region, true
+		}
+	}
+	return PlanRegion{}, false
+}
+
+func findPlan(plans []Plan, slugOrID string) (Plan, bool) {
+	for _, p := range plans {
+		if p.Slug == slugOrID || p.ID == slugOrID {
+			return p, true
+		}
+	}
+	return Plan{}, false
+}
+
+// EstimateCost returns the projected cost of creating the requested servers,
+// from the pricing of their plan in their site. Requests without a billing
+// type are estimated as hourly, and requests the plan has no price for in
+// the currency are marked Unpriced.
+func EstimateCost(plans []Plan, requests []ServerCreateRequest, currency PricingCurrency) (*CostReport, error) {
+	if currency == "" {
+		currency = CurrencyUSD
+	}
+	report := &CostReport{Currency: currency}
+	for i, req := range requests {
+		attrs := req.Data.Attributes
+		plan, ok := findPlan(plans, attrs.Plan)
+		if !ok {
+			return nil, fmt.Errorf("request %d: unknown plan %q", i, attrs.Plan)
+		}
+		region, ok := planRegionForSite(plan, attrs.Site)
+		if !ok {
+			return nil, fmt.Errorf("request %d: plan %q is not available in site %q", i, attrs.Plan, attrs.Site)
+		}
+		billing := BillingType(attrs.Billing)
+		if billing == "" {
+			billing = BillingHourly
+		}
+		price := region.PlanPricing.Price(currency, billing)
+		report.Lines = append(report.Lines, CostLine{
+			Project:   attrs.Project,
+			Hostname:  attrs.Hostname,
+			Plan:      plan.Slug,
+			Site:      strings.ToUpper(attrs.Site),
+			Region:    region.Name,
+			Billing:   billing,
+			Price:     price,
+			Monthly:   MonthlyCost(price, billing),
+			Estimated: true,
+			Unpriced:  price <= 0,
+		})
+	}
+	return report, nil
+}
+
+// ServerCost returns the current cost of existing servers. The price the API
+// reports for a server is used when it is in the report currency, otherwise
+// the cost is estimated from the plan pricing. Servers priced by neither are
+// marked Unpriced.
+func ServerCost(plans []Plan, servers []Server, currency PricingCurrency) *CostReport {
+	if currency == "" {
+		currency = CurrencyUSD
+	}
+	report := &CostReport{Currency: currency}
+	for _, s := range servers {
+		billing := BillingType(s.Plan.Billing)
+		if billing == "" {
+			billing = BillingHourly
+		}
+		line := CostLine{
+			Project:  s.Project.Name,
+			Hostname: s.Hostname,
+			Plan:     s.Plan.Slug,
+			Site:     s.Region.Site.Slug,
+			Region:   s.Region.Country,
+			Tags:     embedTagNames(s.Tags),
+			Billing:  billing,
+		}
+		if s.Price > 0 && strings.EqualFold(s.Team.Currency.Code, string(currency)) {
+			line.Price = s.Price
+		} else if plan, ok := findPlan(plans, s.Plan.Slug); ok {
+			if region, ok := planRegionForSite(plan, s.Region.Site.Slug); ok {
+				line.Price = region.PlanPricing.Price(currency, billing)
+				line.Estimated = line.Price > 0
+			}
+		}
+		line.Unpriced = line.Price <= 0
+		line.Monthly = MonthlyCost(line.Price, billing)
+		report.Lines = append(report.Lines, line)
+	}
+	sort.SliceStable(report.Lines, func(i, j int) bool {
+		if report.Lines[i].Project != report.Lines[j].Project {
+			return report.Lines[i].Project < report.Lines[j].Project
+		}
+		return report.Lines[i].Hostname < report.Lines[j].Hostname
+	})
+	return report
+}
+
+// CostCalculator reports spend through the client services
+type CostCalculator struct {
+	client   *Client
+	currency PricingCurrency
+}
+
+// NewCostCalculator returns a CostCalculator reporting in the given currency
+func NewCostCalculator(c *Client, currency PricingCurrency) *CostCalculator {
+	return &CostCalculator{client: c, currency: currency}
+}
+
+// Estimate returns the projected cost of creating the requested servers
+func (cc *CostCalculator) Estimate(requests []ServerCreateRequest) (*CostReport, error) {
+	plans, _, err := cc.client.Plans.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	return EstimateCost(plans, requests, cc.currency)
+}
+
+// ProjectSpend returns the current cost of the servers of a project
+func (cc *CostCalculator) ProjectSpend(projectID string) (*CostReport, error) {
+	plans, _, err := cc.client.Plans.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	servers, _, err := cc.client.Servers.List(projectID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ServerCost(plans, servers, cc.currency), nil
+}
+
+// TeamSpend returns the current cost of the servers of every project of the team
+func (cc *CostCalculator) TeamSpend() (*CostReport, error) {
+	plans, _, err := cc.client.Plans.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	projects, _, err := cc.client.Projects.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	var servers []Server
+	for _, p := range projects {
+		ps, _, err := cc.client.Servers.List(p.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, ps...)
+	}
+	return ServerCost(plans, servers, cc.currency), nil
+}
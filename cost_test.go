@@ -0,0 +1,82 @@
+package latitude
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	reqs, err := NewBulkCreateRequests(ServerCreateRequest{
+		Data: ServerCreateData{
+			Type:       testServerType,
+			Attributes: ServerCreateAttributes{Project: "shop", Plan: "c2-small-x86", Site: "SAO", Billing: "monthly"},
+		},
+	}, 2, "web-%d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs = append(reqs, ServerCreateRequest{Data: ServerCreateData{Attributes: ServerCreateAttributes{Project: "shop", Plan: "c2-small-x86", Site: "dal"}}})
+
+	report, err := EstimateCost(testPlacementPlans(), reqs, CurrencyUSD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(report.Lines), 3, "Estimated lines")
+	assertEqual(t, math.Round(report.Lines[2].Monthly*100)/100, 153.3, "Hourly projection")
+	assertEqual(t, report.ByRegion()["Brazil"], 306.0, "Brazil cost")
+	assertEqual(t, math.Round(report.ByProject()["shop"]*100)/100, 459.3, "Project cost")
+
+	reqs[0].Data.Attributes.Site = "FRA"
+	if _, err := EstimateCost(testPlacementPlans(), reqs, CurrencyUSD); err == nil {
+		t.Fatal("expected an error for a site the plan isn't available in")
+	}
+}
+
+func TestServerCost(t *testing.T) {
+	servers := []Server{
+		{
+			Hostname: "web-1",
+			Price:    1349,
+			Project:  ServerProject{Name: "shop"},
+			Plan:     ServerPlan{Slug: "c2-small-x86", Billing: "yearly"},
+			Region:   ServerRegion{Country: "Brazil", Site: ServerSite{Slug: "SAO"}},
+			Team:     ServerTeam{Currency: TeamCurrency{Code: "USD"}},
+			Tags:     []EmbedTag{{Name: "web"}, {Name: "prod"}},
+		},
+		{
+			Hostname: "db-1",
+			Project:  ServerProject{Name: "shop"},
+			Plan:     ServerPlan{Slug: "c2-small-x86", Billing: "monthly"},
+			Region:   ServerRegion{Country: "United States", Site: ServerSite{Slug: "DAL"}},
+		},
+		{
+			Hostname: "ml-1",
+			Project:  ServerProject{Name: "shop"},
+			Plan:     ServerPlan{Slug: "m4-metal-large", Billing: "monthly"},
+			Region:   ServerRegion{Country: "Brazil", Site: ServerSite{Slug: "SAO"}},
+		},
+	}
+
+	report := ServerCost(testPlacementPlans(), servers, CurrencyUSD)
+	assertEqual(t, report.Lines[0].Hostname, "db-1", "Sorted by hostname")
+	assertEqual(t, report.Lines[0].Estimated, true, "Estimated from plan pricing")
+	assertEqual(t, report.Lines[0].Monthly, 146.0, "Monthly plan price")
+	assertEqual(t, report.Lines[2].Monthly, 1349.0/12, "Yearly server price")
+	assertEqual(t, report.ByTag()["web"], 1349.0/12, "Tag cost")
+	assertEqual(t, report.ByTag()[""], 146.0, "Untagged cost")
+	assertEqual(t, report.Lines[1].Hostname, "ml-1", "Unpriced line")
+	assertEqual(t, report.Lines[1].Unpriced, true, "Unpriced")
+	assertEqual(t, strings.Join(report.Unpriced(), ","), "ml-1", "Unpriced hostnames")
+	assertEqual(t, report.Total(), 146.0+1349.0/12, "Total of priced lines")
+
+	var out bytes.Buffer
+	if err := report.WriteCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assertEqual(t, len(lines), 4, "CSV rows")
+	assertEqual(t, lines[2], "shop,ml-1,m4-metal-large,SAO,Brazil,,monthly,USD,0.00,0.00,false,true", "Unpriced CSV row")
+	assertEqual(t, lines[3], "shop,web-1,c2-small-x86,SAO,Brazil,web;prod,yearly,USD,1349.00,112.42,false,false", "CSV row")
+}
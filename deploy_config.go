@@ -0,0 +1,212 @@
+package latitude
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const deployConfigPath = "deploy_config"
+
+// DeployConfigService interface defines available server deploy configuration methods
+type DeployConfigService interface {
+	Get(serverID string) (*DeployConfig, *Response, error)
+	Update(serverID string, updateRequest *DeployConfigUpdateRequest) (*DeployConfig, *Response, error)
+}
+
+// DeployConfigServiceOp implements DeployConfigService
+type DeployConfigServiceOp struct {
+	client requestDoer
+}
+
+// RaidLevel is a software RAID layout applied to the server drives on deploy
+type RaidLevel string
+
+const (
+	RaidNone RaidLevel = ""
+	Raid0    RaidLevel = "raid-0"
+	Raid1    RaidLevel = "raid-1"
+)
+
+// minDrives returns the number of drives the RAID level needs
+func (r RaidLevel) minDrives() int {
+	switch r {
+	case Raid0, Raid1:
+		return 2
+	}
+	return 1
+}
+
+// Partition is a filesystem created on deploy
+type Partition struct {
+	Path           string `json:"path"`
+	SizeInGB       int    `json:"size_in_gb"`
+	FilesystemType string `json:"filesystem_type"`
+}
+
+// DeployConfig is the configuration a server is deployed or reinstalled with
+type DeployConfig struct {
+	ID              string      `json:"id"`
+	OperatingSystem string      `json:"operating_system"`
+	Hostname        string      `json:"hostname"`
+	Raid            RaidLevel   `json:"raid"`
+	Partitions      []Partition `json:"partitions"`
+	SSHKeys         []string    `json:"ssh_keys"`
+	UserData        string      `json:"user_data"`
+	IpxeUrl         string      `json:"ipxe_url"`
+}
+
+type DeployConfigGetResponse struct {
+	Data DeployConfigData `json:"data"`
+	Meta meta             `json:"meta"`
+}
+
+type DeployConfigData struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes DeployConfigAttributes `json:"attributes"`
+}
+
+type DeployConfigAttributes struct {
+	OperatingSystem string      `json:"operating_system"`
+	Hostname        string      `json:"hostname"`
+	Raid            RaidLevel   `json:"raid"`
+	Partitions      []Partition `json:"partitions"`
+	SSHKeys         []string    `json:"ssh_keys"`
+	UserData        string      `json:"user_data"`
+	IpxeUrl         string      `json:"ipxe_url"`
+}
+
+// DeployConfigUpdateRequest type used to update a server deploy configuration
+type DeployConfigUpdateRequest struct {
+	Data DeployConfigUpdateData `json:"data"`
+}
+
+type DeployConfigUpdateData struct {
+	ID         string                       `json:"id,omitempty"`
+	Type       string                       `json:"type"`
+	Attributes DeployConfigUpdateAttributes `json:"attributes"`
+}
+
+type DeployConfigUpdateAttributes struct {
+	OperatingSystem string      `json:"operating_system,omitempty"`
+	Hostname        string      `json:"hostname,omitempty"`
+	Raid            RaidLevel   `json:"raid,omitempty"`
+	Partitions      []Partition `json:"partitions,omitempty"`
+	SSHKeys         []string    `json:"ssh_keys,omitempty"`
+	UserData        string      `json:"user_data,omitempty"`
+	IpxeUrl         string      `json:"ipxe_url,omitempty"`
+}
+
+func NewFlatDeployConfig(dd DeployConfigData) DeployConfig {
+	return DeployConfig{
+		ID:              dd.ID,
+		OperatingSystem: dd.Attributes.OperatingSystem,
+		Hostname:        dd.Attributes.Hostname,
+		Raid:            dd.Attributes.Raid,
+		Partitions:      dd.Attributes.Partitions,
+		SSHKeys:         dd.Attributes.SSHKeys,
+		UserData:        dd.Attributes.UserData,
+		IpxeUrl:         dd.Attributes.IpxeUrl,
+	}
+}
+
+// Validate checks the RAID level and partition layout against the drives of
+// the server plan, so that a layout the hardware can't hold is caught before
+// the server is reinstalled. All violations are reported in a *ValidationError.
+func (a DeployConfigUpdateAttributes) Validate(specs PlanSpecs) error {
+	return validateDiskLayout(a.Raid, a.Partitions, specs.Drives)
+}
+
+func validateDiskLayout(raid RaidLevel, partitions []Partition, drives []PlanDrive) error {
+	verr := &ValidationError{}
+
+	switch raid {
+	case RaidNone, Raid0, Raid1:
+	default:
+		verr.add("raid", "unsupported RAID level %q", raid)
+	}
+
+	// RAID is only built across drives of the same size and type, so the
+	// usable capacity is that of the largest set that fits the RAID level
+	capacity := 0.0
+	for i, d := range drives {
+		size, err := parseSizeGB(d.Size)
+		if err != nil {
+			verr.add(fmt.Sprintf("drives[%d]", i), "%s", err)
+			continue
+		}
+		if d.Count < raid.minDrives() {
+			continue
+		}
+		usable := size
+		if raid == Raid0 {
+			usable = size * float64(d.Count)
+		}
+		if usable > capacity {
+			capacity = usable
+		}
+	}
+	if len(drives) > 0 && capacity == 0 && raid != RaidNone {
+		verr.add("raid", "%s needs at least %d drives of the same type and size", raid, raid.minDrives())
+	}
+
+	total := 0
+	paths := map[string]bool{}
+	for i, p := range partitions {
+		field := fmt.Sprintf("partitions[%d]", i)
+		if !strings.HasPrefix(p.Path, "/") {
+			verr.add(field+".path", "mount point %q must be an absolute path", p.Path)
+		}
+		if paths[p.Path] {
+			verr.add(field+".path", "mount point %q is used more than once", p.Path)
+		}
+		paths[p.Path] = true
+		if p.SizeInGB <= 0 {
+			verr.add(field+".size_in_gb", "size must be greater than zero")
+		}
+		total += p.SizeInGB
+	}
+	if len(partitions) > 0 && !paths["/"] {
+		verr.add("partitions", "a partition mounted at / is required")
+	}
+	if capacity > 0 && float64(total) > capacity {
+		verr.add("partitions", "partitions need %d GB but only %.0f GB are available", total, capacity)
+	}
+
+	return verr.errOrNil()
+}
+
+// Get returns the deploy configuration of a server
+func (s *DeployConfigServiceOp) Get(serverID string) (*DeployConfig, *Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, deployConfigPath)
+	deployConfig := new(DeployConfigGetResponse)
+
+	resp, err := s.client.DoRequest("GET", apiPath, nil, deployConfig)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	flatDeployConfig := NewFlatDeployConfig(deployConfig.Data)
+	return &flatDeployConfig, resp, err
+}
+
+// Update updates the deploy configuration of a server. The new configuration
+// is applied on the next reinstall.
+func (s *DeployConfigServiceOp) Update(serverID string, updateRequest *DeployConfigUpdateRequest) (*DeployConfig, *Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, deployConfigPath)
+	deployConfig := new(DeployConfigGetResponse)
+
+	// Set type if not specified
+	if updateRequest.Data.Type == "" {
+		updateRequest.Data.Type = "deploy_config"
+	}
+
+	resp, err := s.client.DoRequest("PATCH", apiPath, updateRequest, deployConfig)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	flatDeployConfig := NewFlatDeployConfig(deployConfig.Data)
+	return &flatDeployConfig, resp, err
+}
@@ -0,0 +1,91 @@
+package latitude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestDeployConfigGetUpdate(t *testing.T) {
+	var body DeployConfigUpdateRequest
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, r.URL.Path, "/servers/sv_1/deploy_config", "Deploy config path")
+		if r.Method == "PATCH" {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fmt.Fprint(w, `{"data":{"id":"dc_1","type":"deploy_config","attributes":{"operating_system":"ubuntu_24_04_x64_lts","hostname":"web-1","raid":"raid-1","partitions":[{"path":"/","size_in_gb":100,"filesystem_type":"ext4"}],"ssh_keys":["ssh_1"]}}}`)
+	})
+
+	dc, _, err := c.DeployConfigs.Get("sv_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, dc.Raid, Raid1, "Deploy config RAID")
+	assertEqual(t, len(dc.Partitions), 1, "Deploy config partitions")
+	assertEqual(t, dc.Partitions[0].SizeInGB, 100, "Deploy config partition size")
+
+	dur := DeployConfigUpdateRequest{
+		Data: DeployConfigUpdateData{
+			Attributes: DeployConfigUpdateAttributes{Hostname: "web-1"},
+		},
+	}
+	if _, _, err := c.DeployConfigs.Update("sv_1", &dur); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, body.Data.Type, "deploy_config", "Deploy config update type")
+	assertEqual(t, body.Data.Attributes.Hostname, "web-1", "Deploy config update hostname")
+}
+
+func TestDeployConfigValidate(t *testing.T) {
+	specs := PlanSpecs{Drives: []PlanDrive{{Count: 2, Size: "480GB", Type: "NVME"}, {Count: 1, Size: "1.9 TB", Type: "NVME"}}}
+
+	valid := DeployConfigUpdateAttributes{
+		Raid: Raid1,
+		Partitions: []Partition{
+			{Path: "/", SizeInGB: 200, FilesystemType: "ext4"},
+			{Path: "/var", SizeInGB: 200, FilesystemType: "ext4"},
+		},
+	}
+	if err := valid.Validate(specs); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := DeployConfigUpdateAttributes{
+		Raid: Raid1,
+		Partitions: []Partition{
+			{Path: "var", SizeInGB: 300},
+			{Path: "var", SizeInGB: 300},
+			{Path: "/data", SizeInGB: 0},
+		},
+	}
+	err := invalid.Validate(specs)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	// relative path twice, duplicate path, zero size, missing root, over capacity
+	assertEqual(t, len(verr.Violations), 6, "Deploy config violations")
+
+	noRaid := DeployConfigUpdateAttributes{Raid: Raid0}
+	if err := noRaid.Validate(PlanSpecs{Drives: []PlanDrive{{Count: 1, Size: "500 GB"}}}); err == nil {
+		t.Fatal("expected RAID 0 on a single drive to fail")
+	}
+}
+
+func TestParseSizeGB(t *testing.T) {
+	cases := map[string]float64{"480GB": 480, "1.9 TB": 1900, "3.8TB": 3800, "64": 64, "512 MB": 0.512}
+	for in, want := range cases {
+		got, err := parseSizeGB(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, got, want, in)
+	}
+	if _, err := parseSizeGB("big"); err == nil {
+		t.Fatal("expected an error for an invalid size")
+	}
+}
@@ -0,0 +1,215 @@
+package latitude
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FirewallServerSelector selects the servers a firewall should be assigned
+// to. A server is selected when it matches any of the fields.
+type FirewallServerSelector struct {
+	IDs       []string
+	Hostnames []string
+
+	// Tags selects the servers with any of the tags, by name or ID
+	Tags []string
+}
+
+func (sel FirewallServerSelector) matches(s Server) bool {
+	if containsFold(sel.IDs, s.ID) || containsFold(sel.Hostnames, s.Hostname) {
+		return true
+	}
+	for _, t := range s.Tags {
+		if containsFold(sel.Tags, t.Name) || containsFold(sel.Tags, t.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirewallAssignmentAction is what EnsureAssignments did for a server
+type FirewallAssignmentAction string
+
+const (
+	FirewallAssignmentCreated FirewallAssignmentAction = "created"
+	FirewallAssignmentDeleted FirewallAssignmentAction = "deleted"
+	FirewallAssignmentKept    FirewallAssignmentAction = "kept"
+)
+
+// FirewallAssignmentReport is the outcome of EnsureAssignments for a server.
+// Err is set when the action failed, or when a selected ID or hostname
+// doesn't match any server of the firewall project.
+type FirewallAssignmentReport struct {
+	ServerID     string
+	Hostname     string
+	Action       FirewallAssignmentAction
+	AssignmentID string
+	Err          error
+}
+
+// FirewallAssignmentReports holds one report per server, sorted by hostname
+type FirewallAssignmentReports []FirewallAssignmentReport
+
+// Failed returns the reports of the servers whose action failed
+func (rs FirewallAssignmentReports) Failed() FirewallAssignmentReports {
+	var res FirewallAssignmentReports
+	for _, r := range rs {
+		if r.Err != nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// EnsureAssignmentsOptions controls how FirewallService.EnsureAssignments runs
+type EnsureAssignmentsOptions struct {
+	// Concurrency is the maximum number of assignments created or deleted at
+	// once. Defaults to 5.
+	Concurrency int
+
+	// KeepUnselected leaves the assignments of servers that aren't selected
+	// in place instead of deleting them
+	KeepUnselected bool
+}
+
+// EnsureAssignments assigns the firewall to exactly the selected servers of
+// its project. Only the missing assignments are created and the extra ones
+// deleted, concurrently. Assignments to servers outside the project are
+// treated as unselected unless the selector names them. The returned reports
+// hold one entry per selected or previously assigned server, and the error is
+// only set when the current state could not be read.
+func (s *FirewallServiceOp) EnsureAssignments(firewallID string, selector FirewallServerSelector, opts *EnsureAssignmentsOptions) (FirewallAssignmentReports, error) {
+	if opts == nil {
+		opts = &EnsureAssignmentsOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	firewall, _, err := s.Get(firewallID, nil)
+	if err != nil {
+		return nil, err
+	}
+	servers, _, err := s.servers.List(firewall.Project.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	assignments, _, err := s.ListAssignments(firewallID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := map[string]FirewallAssignment{}
+	for _, a := range assignments {
+		assigned[a.Server.ID] = a
+	}
+
+	var (
+		reports FirewallAssignmentReports
+		jobs    []func() FirewallAssignmentReport
+		found   = map[string]bool{}
+	)
+	for _, srv := range servers {
+		selected := selector.matches(srv)
+		a, isAssigned := assigned[srv.ID]
+		if selected {
+			found[srv.ID], found[srv.Hostname] = true, true
+		}
+		switch {
+		case selected && isAssigned:
+			reports = append(reports, FirewallAssignmentReport{ServerID: srv.ID, Hostname: srv.Hostname, Action: FirewallAssignmentKept, AssignmentID: a.ID})
+		case selected:
+			jobs = append(jobs, func() FirewallAssignmentReport {
+				r := FirewallAssignmentReport{ServerID: srv.ID, Hostname: srv.Hostname, Action: FirewallAssignmentCreated}
+				created, _, err := s.CreateAssignment(firewallID, &FirewallAssignmentCreateRequest{
+					Data: FirewallAssignmentCreateData{Attributes: FirewallAssignmentCreateAttributes{Server: srv.ID}},
+				})
+				if err != nil {
+					r.Err = err
+				} else {
+					r.AssignmentID = created.ID
+				}
+				return r
+			})
+		case isAssigned && !opts.KeepUnselected:
+			jobs = append(jobs, func() FirewallAssignmentReport {
+				r := FirewallAssignmentReport{ServerID: srv.ID, Hostname: srv.Hostname, Action: FirewallAssignmentDeleted, AssignmentID: a.ID}
+				_, r.Err = s.DeleteAssignment(firewallID, a.ID)
+				return r
+			})
+		case isAssigned:
+			reports = append(reports, FirewallAssignmentReport{ServerID: srv.ID, Hostname: srv.Hostname, Action: FirewallAssignmentKept, AssignmentID: a.ID})
+		}
+	}
+
+	// assignments to servers outside the project listing, such as servers
+	// moved to another project, are deleted like unselected ones unless the
+	// selector names them
+	listed := map[string]bool{}
+	for _, srv := range servers {
+		listed[srv.ID] = true
+	}
+	for _, a := range assignments {
+		if listed[a.Server.ID] {
+			continue
+		}
+		srv := a.Server
+		report := FirewallAssignmentReport{ServerID: srv.ID, Hostname: srv.Hostname, Action: FirewallAssignmentKept, AssignmentID: a.ID}
+		switch {
+		case selector.matches(srv):
+			found[srv.ID] = true
+			if srv.Hostname != "" {
+				found[srv.Hostname] = true
+			}
+			reports = append(reports, report)
+		case !opts.KeepUnselected:
+			jobs = append(jobs, func() FirewallAssignmentReport {
+				report.Action = FirewallAssignmentDeleted
+				_, report.Err = s.DeleteAssignment(firewallID, a.ID)
+				return report
+			})
+		default:
+			reports = append(reports, report)
+		}
+	}
+
+	for _, id := range selector.IDs {
+		if !found[id] {
+			reports = append(reports, FirewallAssignmentReport{ServerID: id, Err: fmt.Errorf("server %s not found in project %s", id, firewall.Project.ID)})
+		}
+	}
+	for _, hostname := range selector.Hostnames {
+		if !found[hostname] {
+			reports = append(reports, FirewallAssignmentReport{Hostname: hostname, Err: fmt.Errorf("server %s not found in project %s", hostname, firewall.Project.ID)})
+		}
+	}
+
+	results := make([]FirewallAssignmentReport, len(jobs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = jobs[i]()
+			}
+		}()
+	}
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	reports = append(reports, results...)
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].Hostname != reports[j].Hostname {
+			return reports[i].Hostname < reports[j].Hostname
+		}
+		return reports[i].ServerID < reports[j].ServerID
+	})
+	return reports, nil
+}
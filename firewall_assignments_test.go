@@ -0,0 +1,79 @@
+package latitude
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFirewallEnsureAssignments(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created []string
+		deleted []string
+	)
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /firewalls/fw_1":
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"web","project":{"id":"proj_1"}}}}`)
+		case "GET /servers":
+			assertEqual(t, r.URL.Query().Get("filter[project]"), "proj_1", "Project filter")
+			fmt.Fprint(w, `{"data":[
+				{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","tags":[{"id":"tag_1","name":"web"}]}},
+				{"id":"sv_2","type":"servers","attributes":{"hostname":"web-2","tags":[{"id":"tag_1","name":"web"}]}},
+				{"id":"sv_3","type":"servers","attributes":{"hostname":"db-1"}},
+				{"id":"sv_4","type":"servers","attributes":{"hostname":"cache-1"}}
+			]}`)
+		case "GET /firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":[
+				{"id":"fwasg_1","type":"firewall_server","attributes":{"server":{"id":"sv_1"}}},
+				{"id":"fwasg_3","type":"firewall_server","attributes":{"server":{"id":"sv_3"}}},
+				{"id":"fwasg_9","type":"firewall_server","attributes":{"server":{"id":"sv_9","hostname":"moved-1"}}}
+			]}`)
+		case "POST /firewalls/fw_1/assignments":
+			body, _ := io.ReadAll(r.Body)
+			created = append(created, string(body))
+			fmt.Fprint(w, `{"data":{"id":"fwasg_new","type":"firewall_server","attributes":{}}}`)
+		case "DELETE /firewalls/fw_1/assignments/fwasg_3", "DELETE /firewalls/fw_1/assignments/fwasg_9":
+			deleted = append(deleted, path.Base(r.URL.Path))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	})
+
+	reports, err := c.Firewalls.EnsureAssignments("fw_1", FirewallServerSelector{Tags: []string{"web"}, Hostnames: []string{"cache-1", "ghost"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		hostname string
+		action   FirewallAssignmentAction
+		failed   bool
+	}{
+		{"cache-1", FirewallAssignmentCreated, false},
+		{"db-1", FirewallAssignmentDeleted, false},
+		{"ghost", "", true},
+		{"moved-1", FirewallAssignmentDeleted, false},
+		{"web-1", FirewallAssignmentKept, false},
+		{"web-2", FirewallAssignmentCreated, false},
+	}
+	assertEqual(t, len(reports), len(expected), "Reports")
+	for i, e := range expected {
+		assertEqual(t, reports[i].Hostname, e.hostname, "Report hostname")
+		assertEqual(t, reports[i].Action, e.action, "Report action")
+		assertEqual(t, reports[i].Err != nil, e.failed, "Report failed")
+	}
+	assertEqual(t, len(reports.Failed()), 1, "Failed reports")
+	assertEqual(t, len(created), 2, "Created assignments")
+	sort.Strings(created)
+	assertEqual(t, strings.Contains(created[0], `"server_id":"sv_2"`) || strings.Contains(created[1], `"server_id":"sv_2"`), true, "Created assignment for web-2")
+	assertEqual(t, len(deleted), 2, "Deleted assignments")
+}
@@ -0,0 +1,529 @@
+package latitude
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// FirewallConversionIssue is something that could not be converted between
+// firewall rules and a host firewall format
+type FirewallConversionIssue struct {
+	// Line is the line of the imported text, 0 on export
+	Line int
+	// Rule is the index of the exported rule, -1 on import
+	Rule   int
+	Text   string
+	Reason string
+}
+
+func (i FirewallConversionIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %q", i.Line, i.Reason, i.Text)
+	}
+	return fmt.Sprintf("rule %d: %s", i.Rule, i.Reason)
+}
+
+// iptablesMultiportMax is the most ports a multiport match takes, a range
+// counting as two
+const iptablesMultiportMax = 15
+
+// exportableRules parses the rules to export, reporting invalid ones
+func exportableRules(rules []FirewallRule) ([]parsedFirewallRule, []int, []FirewallConversionIssue) {
+	var (
+		parsed  []parsedFirewallRule
+		indexes []int
+		issues  []FirewallConversionIssue
+	)
+	for i, r := range rules {
+		p, err := parseFirewallRule(r)
+		if err != nil {
+			issues = append(issues, FirewallConversionIssue{Rule: i, Text: formatFirewallRule(r), Reason: err.Error()})
+			continue
+		}
+		parsed = append(parsed, p)
+		indexes = append(indexes, i)
+	}
+	return parsed, indexes, issues
+}
+
+// ruleFamily returns 4 or 6 for a rule bound to an IP family, 0 otherwise
+func ruleFamily(r parsedFirewallRule) int {
+	for _, p := range []netip.Prefix{r.from, r.to} {
+		if p.IsValid() {
+			if p.Addr().Is4() {
+				return 4
+			}
+			return 6
+		}
+	}
+	return 0
+}
+
+func joinPorts(ranges []portRange, rangeSep, listSep string) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+		if r.lo != r.hi {
+			parts[i] = fmt.Sprintf("%d%s%d", r.lo, rangeSep, r.hi)
+		}
+	}
+	return strings.Join(parts, listSep)
+}
+
+// ExportIptables converts the rules to iptables-save input rules on a chain
+// with a DROP policy. iptables only handles IPv4, so IPv6 rules are reported
+// as issues.
+func ExportIptables(rules []FirewallRule) (string, []FirewallConversionIssue) {
+	parsed, indexes, issues := exportableRules(rules)
+
+	var b strings.Builder
+	b.WriteString("*filter\n:INPUT DROP [0:0]\n")
+	for n, r := range parsed {
+		if ruleFamily(r) == 6 {
+			issues = append(issues, FirewallConversionIssue{Rule: indexes[n], Text: formatFirewallRule(rules[indexes[n]]), Reason: "IPv6 rules can't be expressed in iptables, use ip6tables"})
+			continue
+		}
+		match := "-A INPUT"
+		if r.from.IsValid() {
+			match += " -s " + r.from.String()
+		}
+		if r.to.IsValid() {
+			match += " -d " + r.to.String()
+		}
+		proto := strings.ToLower(string(r.protocol))
+		match += " -p " + proto
+
+		if r.ports == nil {
+			fmt.Fprintf(&b, "%s -j ACCEPT\n", match)
+			continue
+		}
+		if len(r.ports) == 1 {
+			fmt.Fprintf(&b, "%s -m %s --dport %s -j ACCEPT\n", match, proto, joinPorts(r.ports, ":", ","))
+			continue
+		}
+		// split port lists over several multiport matches when too long
+		var chunk []portRange
+		size := 0
+		flush := func() {
+			fmt.Fprintf(&b, "%s -m multiport --dports %s -j ACCEPT\n", match, joinPorts(chunk, ":", ","))
+			chunk, size = nil, 0
+		}
+		for _, pr := range r.ports {
+			w := 1
+			if pr.lo != pr.hi {
+				w = 2
+			}
+			if size+w > iptablesMultiportMax {
+				flush()
+			}
+			chunk = append(chunk, pr)
+			size += w
+		}
+		flush()
+	}
+	b.WriteString("COMMIT\n")
+	return b.String(), issues
+}
+
+// ExportNft converts the rules to an nft ruleset with an inet table whose
+// input chain drops unmatched traffic
+func ExportNft(rules []FirewallRule) (string, []FirewallConversionIssue) {
+	parsed, _, issues := exportableRules(rules)
+
+	var b strings.Builder
+	b.WriteString("table inet filter {\n\tchain input {\n\t\ttype filter hook input priority 0; policy drop;\n")
+	for _, r := range parsed {
+		var stmt []string
+		for _, a := range []struct {
+			dir string
+			p   netip.Prefix
+		}{{"saddr", r.from}, {"daddr", r.to}} {
+			if !a.p.IsValid() {
+				continue
+			}
+			family := "ip"
+			if a.p.Addr().Is6() {
+				family = "ip6"
+			}
+			stmt = append(stmt, fmt.Sprintf("%s %s %s", family, a.dir, formatFirewallAddress(a.p)))
+		}
+		proto := strings.ToLower(string(r.protocol))
+		switch {
+		case r.ports == nil:
+			stmt = append(stmt, "meta l4proto "+proto)
+		case len(r.ports) == 1:
+			stmt = append(stmt, fmt.Sprintf("%s dport %s", proto, joinPorts(r.ports, "-", ", ")))
+		default:
+			stmt = append(stmt, fmt.Sprintf("%s dport { %s }", proto, joinPorts(r.ports, "-", ", ")))
+		}
+		fmt.Fprintf(&b, "\t\t%s accept\n", strings.Join(stmt, " "))
+	}
+	b.WriteString("\t}\n}\n")
+	return b.String(), issues
+}
+
+// ExportUfw converts the rules to ufw commands, one per line
+func ExportUfw(rules []FirewallRule) (string, []FirewallConversionIssue) {
+	parsed, _, issues := exportableRules(rules)
+
+	var b strings.Builder
+	for _, r := range parsed {
+		from, to := "any", "any"
+		if r.from.IsValid() {
+			from = formatFirewallAddress(r.from)
+		}
+		if r.to.IsValid() {
+			to = formatFirewallAddress(r.to)
+		}
+		fmt.Fprintf(&b, "ufw allow proto %s from %s to %s", strings.ToLower(string(r.protocol)), from, to)
+		if r.ports != nil {
+			fmt.Fprintf(&b, " port %s", joinPorts(r.ports, ":", ","))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), issues
+}
+
+// importedRule is a rule being read from a host firewall format, where every
+// field may hold several values
+type importedRule struct {
+	froms, tos []string
+	protocols  []string
+	ports      string
+}
+
+// expand returns one rule per combination of the values of the fields,
+// reporting those that fail validation
+func (ir importedRule) expand(line int, text string) ([]FirewallRule, []FirewallConversionIssue) {
+	if len(ir.froms) == 0 {
+		ir.froms = []string{FirewallAny}
+	}
+	if len(ir.tos) == 0 {
+		ir.tos = []string{FirewallAny}
+	}
+	if ir.ports == "" {
+		ir.ports = FirewallAny
+	}
+	var (
+		rules  []FirewallRule
+		issues []FirewallConversionIssue
+	)
+	for _, proto := range ir.protocols {
+		for _, from := range ir.froms {
+			for _, to := range ir.tos {
+				r, err := FirewallRule{From: from, To: to, Port: ir.ports, Protocol: proto}.Normalize()
+				if err != nil {
+					issues = append(issues, FirewallConversionIssue{Line: line, Rule: -1, Text: text, Reason: err.Error()})
+					continue
+				}
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, issues
+}
+
+// importProtocols maps a host firewall protocol to the platform protocols.
+// No protocol means TCP and UDP, other protocols can't be expressed.
+func importProtocols(proto string) ([]string, string) {
+	switch strings.ToLower(proto) {
+	case "", "all", "any":
+		return []string{string(FirewallProtocolTCP), string(FirewallProtocolUDP)}, "only TCP and UDP are imported, other protocols can't be expressed"
+	case "tcp", "6":
+		return []string{string(FirewallProtocolTCP)}, ""
+	case "udp", "17":
+		return []string{string(FirewallProtocolUDP)}, ""
+	}
+	return nil, fmt.Sprintf("protocol %q can't be expressed", proto)
+}
+
+// scanLines calls fn with the number and trimmed text of each non empty,
+// non comment line
+func scanLines(data string, fn func(n int, line string)) {
+	s := bufio.NewScanner(strings.NewReader(data))
+	n := 0
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(n, line)
+	}
+}
+
+// ImportIptables reads the INPUT rules of iptables-save output. Only ACCEPT
+// rules matching addresses, protocols and destination ports can be expressed,
+// anything else is reported.
+func ImportIptables(data string) ([]FirewallRule, []FirewallConversionIssue) {
+	var (
+		rules  []FirewallRule
+		issues []FirewallConversionIssue
+	)
+	report := func(n int, line, reason string) {
+		issues = append(issues, FirewallConversionIssue{Line: n, Rule: -1, Text: line, Reason: reason})
+	}
+
+	table := ""
+	scanLines(data, func(n int, line string) {
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+			return
+		case line == "COMMIT":
+			return
+		case table != "filter":
+			report(n, line, fmt.Sprintf("%s table can't be expressed", table))
+			return
+		case strings.HasPrefix(line, ":"):
+			f := strings.Fields(line[1:])
+			if len(f) >= 2 && f[0] == "INPUT" && f[1] == "ACCEPT" {
+				report(n, line, "ACCEPT policy can't be expressed, unmatched traffic is denied")
+			}
+			return
+		}
+
+		f := strings.Fields(line)
+		if len(f) < 2 || f[0] != "-A" {
+			report(n, line, "unsupported statement")
+			return
+		}
+		if f[1] != "INPUT" {
+			report(n, line, fmt.Sprintf("chain %s can't be expressed, only INPUT rules are imported", f[1]))
+			return
+		}
+
+		ir := importedRule{}
+		proto, target := "", ""
+		for i := 2; i < len(f); i++ {
+			arg := func() string {
+				if i+1 < len(f) {
+					i++
+					return f[i]
+				}
+				return ""
+			}
+			switch f[i] {
+			case "-s", "--source":
+				ir.froms = strings.Split(arg(), ",")
+			case "-d", "--destination":
+				ir.tos = strings.Split(arg(), ",")
+			case "-p", "--protocol":
+				proto = arg()
+			case "--dport", "--destination-port", "--dports", "--destination-ports":
+				ir.ports = strings.ReplaceAll(arg(), ":", "-")
+			case "-m", "--match":
+				if m := arg(); m != "tcp" && m != "udp" && m != "multiport" {
+					report(n, line, fmt.Sprintf("match %q can't be expressed", m))
+					return
+				}
+			case "-j", "--jump":
+				target = arg()
+			default:
+				report(n, line, fmt.Sprintf("option %q can't be expressed", f[i]))
+				return
+			}
+		}
+		if target != "ACCEPT" {
+			report(n, line, fmt.Sprintf("target %q can't be expressed, rules only allow traffic", target))
+			return
+		}
+		protocols, reason := importProtocols(proto)
+		if protocols == nil {
+			report(n, line, reason)
+			return
+		}
+		if reason != "" {
+			report(n, line, reason)
+		}
+		ir.protocols = protocols
+		r, is := ir.expand(n, line)
+		rules, issues = append(rules, r...), append(issues, is...)
+	})
+	return rules, issues
+}
+
+// nftValues returns the values of an nft expression, either a single value
+// or a set such as "{ 80, 443 }", and the number of tokens it spans
+func nftValues(tokens []string) ([]string, int) {
+	if len(tokens) == 0 {
+		return nil, 0
+	}
+	if tokens[0] != "{" {
+		return []string{tokens[0]}, 1
+	}
+	var values []string
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] == "}" {
+			return values, i + 1
+		}
+		values = append(values, strings.TrimSuffix(tokens[i], ","))
+	}
+	return values, len(tokens)
+}
+
+// ImportNft reads the rules of the input hook chains of an nft ruleset. Only
+// accept rules matching addresses, protocols and destination ports can be
+// expressed, anything else is reported.
+func ImportNft(data string) ([]FirewallRule, []FirewallConversionIssue) {
+	var (
+		rules  []FirewallRule
+		issues []FirewallConversionIssue
+	)
+	report := func(n int, line, reason string) {
+		issues = append(issues, FirewallConversionIssue{Line: n, Rule: -1, Text: line, Reason: reason})
+	}
+
+	chain, input := "", false
+	scanLines(data, func(n int, line string) {
+		switch {
+		case strings.HasPrefix(line, "table ") || line == "}":
+			return
+		case strings.HasPrefix(line, "chain "):
+			chain, input = strings.Fields(line)[1], false
+			return
+		case strings.HasPrefix(line, "type "):
+			input = strings.Contains(line, "hook input")
+			if input && strings.Contains(line, "policy accept") {
+				report(n, line, "accept policy can't be expressed, unmatched traffic is denied")
+			}
+			return
+		case !input:
+			report(n, line, fmt.Sprintf("chain %s can't be expressed, only input hook rules are imported", chain))
+			return
+		}
+
+		// spread set braces so they are tokens of their own
+		line = strings.NewReplacer("{", " { ", "}", " } ").Replace(line)
+		tokens := strings.Fields(line)
+		ir := importedRule{}
+		proto, verdict := "", ""
+		for i := 0; i < len(tokens); {
+			t := tokens[i]
+			switch {
+			case (t == "ip" || t == "ip6") && i+1 < len(tokens) && (tokens[i+1] == "saddr" || tokens[i+1] == "daddr"):
+				values, w := nftValues(tokens[i+2:])
+				if tokens[i+1] == "saddr" {
+					ir.froms = values
+				} else {
+					ir.tos = values
+				}
+				i += 2 + w
+			case (t == "tcp" || t == "udp") && i+1 < len(tokens) && tokens[i+1] == "dport":
+				values, w := nftValues(tokens[i+2:])
+				proto, ir.ports = t, strings.Join(values, ",")
+				i += 2 + w
+			case t == "meta" && i+2 < len(tokens) && tokens[i+1] == "l4proto":
+				proto = tokens[i+2]
+				i += 3
+			case t == "accept" || t == "drop" || t == "reject":
+				verdict = t
+				i++
+			case t == "counter":
+				i++
+			default:
+				report(n, line, fmt.Sprintf("expression %q can't be expressed", t))
+				return
+			}
+		}
+		if verdict != "accept" {
+			report(n, line, fmt.Sprintf("verdict %q can't be expressed, rules only allow traffic", verdict))
+			return
+		}
+		protocols, reason := importProtocols(proto)
+		if protocols == nil {
+			report(n, line, reason)
+			return
+		}
+		if reason != "" {
+			report(n, line, reason)
+		}
+		ir.protocols = protocols
+		r, is := ir.expand(n, line)
+		rules, issues = append(rules, r...), append(issues, is...)
+	})
+	return rules, issues
+}
+
+// ImportUfw reads ufw commands such as "ufw allow 22/tcp" or
+// "ufw allow proto tcp from 10.0.0.0/8 to any port 80,443". Only incoming
+// allow rules can be expressed, anything else is reported.
+func ImportUfw(data string) ([]FirewallRule, []FirewallConversionIssue) {
+	var (
+		rules  []FirewallRule
+		issues []FirewallConversionIssue
+	)
+	report := func(n int, line, reason string) {
+		issues = append(issues, FirewallConversionIssue{Line: n, Rule: -1, Text: line, Reason: reason})
+	}
+
+	scanLines(data, func(n int, line string) {
+		f := strings.Fields(line)
+		if len(f) > 0 && f[0] == "ufw" {
+			f = f[1:]
+		}
+		if len(f) > 0 && f[0] == "rule" {
+			f = f[1:]
+		}
+		if len(f) == 0 || f[0] != "allow" {
+			report(n, line, "only allow rules can be expressed")
+			return
+		}
+		f = f[1:]
+		if len(f) > 0 && f[0] == "in" {
+			f = f[1:]
+		}
+		if len(f) > 0 && f[0] == "out" {
+			report(n, line, "outgoing rules can't be expressed")
+			return
+		}
+
+		ir := importedRule{}
+		proto := ""
+		if len(f) == 1 {
+			// simple syntax: "22", "22/tcp" or "3000:4000/udp"
+			port, p, _ := strings.Cut(f[0], "/")
+			if _, err := parseFirewallPorts(strings.ReplaceAll(port, ":", "-")); err != nil {
+				report(n, line, fmt.Sprintf("application profile %q can't be expressed", f[0]))
+				return
+			}
+			ir.ports, proto = strings.ReplaceAll(port, ":", "-"), p
+		} else {
+			for i := 0; i < len(f); i += 2 {
+				if i+1 >= len(f) {
+					report(n, line, fmt.Sprintf("missing value for %q", f[i]))
+					return
+				}
+				v := f[i+1]
+				switch f[i] {
+				case "proto":
+					proto = v
+				case "from":
+					ir.froms = []string{v}
+				case "to":
+					ir.tos = []string{v}
+				case "port":
+					ir.ports = strings.ReplaceAll(v, ":", "-")
+				default:
+					report(n, line, fmt.Sprintf("option %q can't be expressed", f[i]))
+					return
+				}
+			}
+		}
+
+		protocols, reason := importProtocols(proto)
+		if protocols == nil {
+			report(n, line, reason)
+			return
+		}
+		if reason != "" {
+			report(n, line, reason)
+		}
+		ir.protocols = protocols
+		r, is := ir.expand(n, line)
+		rules, issues = append(rules, r...), append(issues, is...)
+	})
+	return rules, issues
+}
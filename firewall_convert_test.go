@@ -0,0 +1,120 @@
+package latitude
+
+import (
+	"testing"
+)
+
+var testConvertRules = []FirewallRule{
+	{From: "10.0.0.0/8", To: "ANY", Port: "80,443", Protocol: "TCP"},
+	{From: "ANY", To: "192.0.2.10", Port: "3000-4000", Protocol: "UDP"},
+	{From: "2001:db8::/32", To: "ANY", Port: "22", Protocol: "TCP"},
+	{From: "ANY", To: "ANY", Port: "ANY", Protocol: "UDP"},
+}
+
+func assertRules(t *testing.T, got, expected []FirewallRule) {
+	t.Helper()
+	assertEqual(t, len(got), len(expected), "Rules")
+	for i := range expected {
+		assertEqual(t, got[i], expected[i], "Rule")
+	}
+}
+
+func TestFirewallIptables(t *testing.T) {
+	out, issues := ExportIptables(testConvertRules)
+	assertEqual(t, out, `*filter
+:INPUT DROP [0:0]
+-A INPUT -s 10.0.0.0/8 -p tcp -m multiport --dports 80,443 -j ACCEPT
+-A INPUT -d 192.0.2.10/32 -p udp -m udp --dport 3000:4000 -j ACCEPT
+-A INPUT -p udp -j ACCEPT
+COMMIT
+`, "iptables export")
+	assertEqual(t, len(issues), 1, "Export issues")
+	assertEqual(t, issues[0].Rule, 2, "Export issue rule")
+
+	rules, issues := ImportIptables(out + `*nat
+-A PREROUTING -p tcp --dport 8080 -j REDIRECT --to-ports 80
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -m state --state ESTABLISHED,RELATED -j ACCEPT
+-A INPUT -p icmp -j ACCEPT
+-A INPUT -s 203.0.113.0/24 -j ACCEPT
+-A INPUT -p tcp --dport 25 -j DROP
+COMMIT
+`)
+	assertRules(t, rules, []FirewallRule{
+		testConvertRules[0], testConvertRules[1], testConvertRules[3],
+		{From: "203.0.113.0/24", To: "ANY", Port: "ANY", Protocol: "TCP"},
+		{From: "203.0.113.0/24", To: "ANY", Port: "ANY", Protocol: "UDP"},
+	})
+	lines := []int{8, 11, 12, 13, 14, 15}
+	assertEqual(t, len(issues), len(lines), "Import issues")
+	for i, l := range lines {
+		assertEqual(t, issues[i].Line, l, "Import issue line")
+	}
+}
+
+func TestFirewallNft(t *testing.T) {
+	out, issues := ExportNft(testConvertRules)
+	assertEqual(t, out, `table inet filter {
+	chain input {
+		type filter hook input priority 0; policy drop;
+		ip saddr 10.0.0.0/8 tcp dport { 80, 443 } accept
+		ip daddr 192.0.2.10 udp dport 3000-4000 accept
+		ip6 saddr 2001:db8::/32 tcp dport 22 accept
+		meta l4proto udp accept
+	}
+}
+`, "nft export")
+	assertEqual(t, len(issues), 0, "Export issues")
+
+	rules, issues := ImportNft(out + `table inet extra {
+	chain input {
+		type filter hook input priority 0; policy accept;
+		ct state established,related accept
+		ip saddr { 198.51.100.1, 198.51.100.2 } tcp dport 5432 counter accept
+		tcp dport 23 drop
+	}
+	chain output {
+		type filter hook output priority 0;
+		tcp dport 25 accept
+	}
+}
+`)
+	assertRules(t, rules, append(append([]FirewallRule{}, testConvertRules...),
+		FirewallRule{From: "198.51.100.1", To: "ANY", Port: "5432", Protocol: "TCP"},
+		FirewallRule{From: "198.51.100.2", To: "ANY", Port: "5432", Protocol: "TCP"},
+	))
+	lines := []int{12, 13, 15, 19}
+	assertEqual(t, len(issues), len(lines), "Import issues")
+	for i, l := range lines {
+		assertEqual(t, issues[i].Line, l, "Import issue line")
+	}
+}
+
+func TestFirewallUfw(t *testing.T) {
+	out, issues := ExportUfw(testConvertRules)
+	assertEqual(t, out, `ufw allow proto tcp from 10.0.0.0/8 to any port 80,443
+ufw allow proto udp from any to 192.0.2.10 port 3000:4000
+ufw allow proto tcp from 2001:db8::/32 to any port 22
+ufw allow proto udp from any to any
+`, "ufw export")
+	assertEqual(t, len(issues), 0, "Export issues")
+
+	rules, issues := ImportUfw(out + `ufw allow 8080/tcp
+ufw allow OpenSSH
+ufw deny 23
+ufw limit ssh
+ufw allow from 203.0.113.4 to any port 53
+`)
+	assertRules(t, rules, append(append([]FirewallRule{}, testConvertRules...),
+		FirewallRule{From: "ANY", To: "ANY", Port: "8080", Protocol: "TCP"},
+		FirewallRule{From: "203.0.113.4", To: "ANY", Port: "53", Protocol: "TCP"},
+		FirewallRule{From: "203.0.113.4", To: "ANY", Port: "53", Protocol: "UDP"},
+	))
+	lines := []int{6, 7, 8, 9}
+	assertEqual(t, len(issues), len(lines), "Import issues")
+	for i, l := range lines {
+		assertEqual(t, issues[i].Line, l, "Import issue line")
+	}
+}
@@ -0,0 +1,129 @@
+package latitude
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FirewallRuleDiff is the difference between the rules of a firewall and a
+// desired rule set. Rules are compared in their normalized form and in any
+// order, and default rules are left out as they are managed by the API.
+type FirewallRuleDiff struct {
+	Added     []FirewallRule
+	Removed   []FirewallRule
+	Unchanged []FirewallRule
+}
+
+// Empty reports whether the rule sets are the same
+func (d *FirewallRuleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// String returns one line per added or removed rule, such as
+// "+ TCP ANY -> 10.0.0.1 port 443"
+func (d *FirewallRuleDiff) String() string {
+	var b strings.Builder
+	for _, r := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", formatFirewallRule(r))
+	}
+	for _, r := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", formatFirewallRule(r))
+	}
+	return b.String()
+}
+
+func formatFirewallRule(r FirewallRule) string {
+	return fmt.Sprintf("%s %s -> %s port %s", r.Protocol, r.From, r.To, r.Port)
+}
+
+func firewallRuleKey(r FirewallRule) string {
+	return strings.Join([]string{r.Protocol, r.From, r.To, r.Port}, "|")
+}
+
+// DiffFirewallRules returns the changes that turn current into desired. The
+// desired rules must be valid, current rules that fail validation are
+// compared as they are.
+func DiffFirewallRules(current, desired []FirewallRule) (*FirewallRuleDiff, error) {
+	want, err := NormalizeFirewallRules(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := map[string][]FirewallRule{}
+	for _, r := range current {
+		if r.Default {
+			continue
+		}
+		if n, err := r.Normalize(); err == nil {
+			r = n
+		}
+		k := firewallRuleKey(r)
+		remaining[k] = append(remaining[k], r)
+	}
+
+	diff := &FirewallRuleDiff{}
+	for _, r := range want {
+		if r.Default {
+			continue
+		}
+		k := firewallRuleKey(r)
+		if len(remaining[k]) > 0 {
+			remaining[k] = remaining[k][1:]
+			diff.Unchanged = append(diff.Unchanged, r)
+			continue
+		}
+		diff.Added = append(diff.Added, r)
+	}
+	for _, r := range current {
+		if r.Default {
+			continue
+		}
+		if n, err := r.Normalize(); err == nil {
+			r = n
+		}
+		k := firewallRuleKey(r)
+		if len(remaining[k]) > 0 {
+			remaining[k] = remaining[k][1:]
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+	return diff, nil
+}
+
+// Diff returns the changes that turn the rules of the firewall into desired
+func (f *Firewall) Diff(desired []FirewallRule) (*FirewallRuleDiff, error) {
+	return DiffFirewallRules(f.Rules, desired)
+}
+
+// Sync makes the rules of the firewall match the desired rules, calling
+// Update only when they differ. It returns the firewall and the diff that
+// was applied, which is empty when nothing changed.
+func (s *FirewallServiceOp) Sync(firewallID string, desired []FirewallRule) (*Firewall, *FirewallRuleDiff, error) {
+	firewall, _, err := s.Get(firewallID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	diff, err := firewall.Diff(desired)
+	if err != nil || diff.Empty() {
+		return firewall, diff, err
+	}
+
+	// a non-nil empty list clears the firewall when every rule is removed
+	rules := []FirewallRule{}
+	for _, r := range desired {
+		if !r.Default {
+			rules = append(rules, r)
+		}
+	}
+
+	request := &FirewallUpdateRequest{Data: FirewallUpdateData{
+		ID:         firewallID,
+		Type:       "firewalls",
+		Attributes: FirewallUpdateAttributes{Name: firewall.Name, Rules: rules},
+	}}
+	updated, _, err := s.Update(firewallID, request)
+	if err != nil {
+		return nil, diff, err
+	}
+	return updated, diff, nil
+}
@@ -0,0 +1,103 @@
+package latitude
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestDiffFirewallRules(t *testing.T) {
+	current := []FirewallRule{
+		{From: "ANY", To: "ANY", Port: "22", Protocol: "TCP", Default: true},
+		{From: "10.0.0.0/8", To: "ANY", Port: "443,80", Protocol: "TCP"},
+		{From: "ANY", To: "ANY", Port: "53", Protocol: "UDP"},
+	}
+	desired := []FirewallRule{
+		{From: "any", To: "any", Port: "5432", Protocol: "tcp"},
+		{From: "10.0.0.1/8", To: "any", Port: "80, 443", Protocol: "tcp"},
+	}
+
+	diff, err := DiffFirewallRules(current, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(diff.Unchanged), 1, "Unchanged rules")
+	assertEqual(t, diff.String(), "- UDP ANY -> ANY port 53\n+ TCP ANY -> ANY port 5432\n", "Diff")
+
+	diff, err = DiffFirewallRules(current, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, diff.Empty(), true, "Diff of the same rules")
+
+	if _, err := DiffFirewallRules(current, []FirewallRule{{From: "ANY", To: "ANY", Port: "80-", Protocol: "TCP"}}); err == nil {
+		t.Fatal("Expected an error for invalid desired rules")
+	}
+}
+
+func TestFirewallSync(t *testing.T) {
+	updates := 0
+	var sent []FirewallRule
+	var sentName string
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"web","rules":[
+				{"from":"ANY","to":"ANY","port":"22","protocol":"TCP","default":true},
+				{"from":"ANY","to":"ANY","port":"80","protocol":"TCP"}
+			]}}}`)
+		case "PATCH":
+			updates++
+			body, _ := io.ReadAll(r.Body)
+			var req struct {
+				Data struct {
+					Attributes struct {
+						Name  string         `json:"name"`
+						Rules []FirewallRule `json:"rules"`
+					} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				t.Error(err)
+			}
+			sent = req.Data.Attributes.Rules
+			sentName = req.Data.Attributes.Name
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"web"}}}`)
+		}
+	})
+
+	_, diff, err := c.Firewalls.Sync("fw_1", []FirewallRule{{From: "any", To: "any", Port: "80", Protocol: "tcp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, diff.Empty(), true, "Diff")
+	assertEqual(t, updates, 0, "Updates")
+
+	_, diff, err = c.Firewalls.Sync("fw_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(diff.Removed), 1, "Removed rules")
+	assertEqual(t, updates, 1, "Updates")
+	assertEqual(t, sent != nil && len(sent) == 0, true, "Rules sent to clear the firewall")
+	assertEqual(t, sentName, "web", "Name sent with the rules")
+}
+
+func TestFirewallUpdateAttributesJSON(t *testing.T) {
+	for _, tc := range []struct {
+		attrs FirewallUpdateAttributes
+		want  string
+	}{
+		{FirewallUpdateAttributes{Name: "web"}, `{"name":"web"}`},
+		{FirewallUpdateAttributes{Name: "web", Rules: []FirewallRule{}}, `{"name":"web","rules":[]}`},
+		{FirewallUpdateAttributes{Rules: []FirewallRule{{From: "ANY", To: "ANY", Port: "80", Protocol: "TCP"}}}, `{"rules":[{"from":"ANY","to":"ANY","port":"80","protocol":"TCP","default":false}]}`},
+	} {
+		b, err := json.Marshal(tc.attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(b), tc.want, "Update attributes JSON")
+	}
+}
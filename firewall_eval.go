@@ -0,0 +1,160 @@
+package latitude
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// FirewallFlow is a connection to evaluate against firewall rules
+type FirewallFlow struct {
+	Source      netip.Addr
+	Destination netip.Addr
+	Port        uint16
+	Protocol    FirewallProtocol
+}
+
+// ParseFirewallFlow builds a flow from text, such as
+// ParseFirewallFlow("203.0.113.5", "", "tcp", 5432). An empty destination
+// leaves it unset.
+func ParseFirewallFlow(source, destination, protocol string, port uint16) (FirewallFlow, error) {
+	flow := FirewallFlow{Port: port, Protocol: FirewallProtocol(strings.ToUpper(protocol))}
+	var err error
+	if flow.Source, err = netip.ParseAddr(source); err != nil {
+		return flow, fmt.Errorf("invalid source address %q", source)
+	}
+	if destination != "" {
+		if flow.Destination, err = netip.ParseAddr(destination); err != nil {
+			return flow, fmt.Errorf("invalid destination address %q", destination)
+		}
+	}
+	return flow, nil
+}
+
+// FirewallVerdict is the outcome of evaluating a flow. When the flow is
+// allowed by a rule, Firewall, Rule and RuleIndex identify the first rule
+// that matched. Unfiltered is set when no firewall applies, so the traffic
+// isn't filtered and the flow is allowed.
+type FirewallVerdict struct {
+	Allowed    bool
+	Unfiltered bool
+	Firewall   *Firewall
+	Rule       *FirewallRule
+	RuleIndex  int
+}
+
+func (v FirewallVerdict) String() string {
+	if v.Unfiltered {
+		return "allow: no firewall assigned"
+	}
+	if !v.Allowed {
+		return "deny: no rule matched"
+	}
+	return fmt.Sprintf("allow: firewall %s rule %d (%s %s -> %s port %s)",
+		v.Firewall.Name, v.RuleIndex, v.Rule.Protocol, v.Rule.From, v.Rule.To, v.Rule.Port)
+}
+
+// matchAddress reports whether addr is within the rule address. An unset addr
+// only matches "any".
+func matchAddress(rule string, addr netip.Addr) bool {
+	p, err := parseFirewallAddress(rule)
+	if err != nil {
+		return false
+	}
+	return !p.IsValid() || (addr.IsValid() && p.Contains(addr.Unmap()))
+}
+
+func matchPort(rule string, port uint16) bool {
+	ranges, err := parseFirewallPorts(rule)
+	if err != nil {
+		return false
+	}
+	if ranges == nil {
+		return true
+	}
+	for _, r := range ranges {
+		if port >= r.lo && port <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the rule matches the flow. Rules that fail
+// validation never match.
+func (r FirewallRule) Matches(flow FirewallFlow) bool {
+	return strings.EqualFold(r.Protocol, string(flow.Protocol)) &&
+		matchAddress(r.From, flow.Source) &&
+		matchAddress(r.To, flow.Destination) &&
+		matchPort(r.Port, flow.Port)
+}
+
+// Evaluate returns whether the firewall allows the flow. Firewall rules only
+// allow traffic: a flow is allowed when a rule matches, and denied when none
+// does. Default rules are added by the platform and allow traffic like any
+// other rule.
+func (f *Firewall) Evaluate(flow FirewallFlow) FirewallVerdict {
+	for i := range f.Rules {
+		if f.Rules[i].Matches(flow) {
+			return FirewallVerdict{Allowed: true, Firewall: f, Rule: &f.Rules[i], RuleIndex: i}
+		}
+	}
+	return FirewallVerdict{}
+}
+
+// EvaluateFirewalls returns whether the flow is allowed by the firewalls
+// together, as when several firewalls are assigned to the same server.
+// Without firewalls the traffic isn't filtered, the verdict is an
+// unfiltered allow.
+func EvaluateFirewalls(firewalls []Firewall, flow FirewallFlow) FirewallVerdict {
+	if len(firewalls) == 0 {
+		return FirewallVerdict{Allowed: true, Unfiltered: true}
+	}
+	for i := range firewalls {
+		if v := firewalls[i].Evaluate(flow); v.Allowed {
+			return v
+		}
+	}
+	return FirewallVerdict{}
+}
+
+// ServerFirewalls returns the firewalls assigned to the server
+func (s *FirewallServiceOp) ServerFirewalls(serverID string) ([]Firewall, error) {
+	firewalls, _, err := s.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	var assigned []Firewall
+	for _, f := range firewalls {
+		assignments, _, err := s.ListAssignments(f.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range assignments {
+			if a.Server.ID == serverID {
+				assigned = append(assigned, f)
+				break
+			}
+		}
+	}
+	return assigned, nil
+}
+
+// EvaluateServer returns whether the firewalls assigned to the server allow
+// the flow. An unset flow destination defaults to the primary IPv4 address of
+// the server.
+func (s *FirewallServiceOp) EvaluateServer(serverID string, flow FirewallFlow) (*FirewallVerdict, error) {
+	firewalls, err := s.ServerFirewalls(serverID)
+	if err != nil {
+		return nil, err
+	}
+	if !flow.Destination.IsValid() {
+		server, _, err := s.servers.Get(serverID, nil)
+		if err != nil {
+			return nil, err
+		}
+		flow.Destination, _ = netip.ParseAddr(server.PrimaryIPv4)
+	}
+	v := EvaluateFirewalls(firewalls, flow)
+	return &v, nil
+}
@@ -0,0 +1,89 @@
+package latitude
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFirewallEvaluate(t *testing.T) {
+	fw := Firewall{Name: "db", Rules: []FirewallRule{
+		{From: "ANY", To: "ANY", Port: "22", Protocol: "TCP", Default: true},
+		{From: "203.0.113.0/24", To: "ANY", Port: "5432", Protocol: "TCP"},
+		{From: "2001:db8::/32", To: "ANY", Port: "5000-6000", Protocol: "TCP"},
+		{From: "ANY", To: "10.0.0.1", Port: "53,123", Protocol: "UDP"},
+	}}
+
+	cases := []struct {
+		source, destination, protocol string
+		port                          uint16
+		allowed                       bool
+		rule                          int
+	}{
+		{"203.0.113.5", "", "tcp", 5432, true, 1},
+		{"198.51.100.1", "", "tcp", 5432, false, 0},
+		{"198.51.100.1", "", "tcp", 22, true, 0},
+		{"2001:db8::5", "", "tcp", 5432, true, 2},
+		{"203.0.113.5", "", "udp", 5432, false, 0},
+		{"198.51.100.1", "10.0.0.1", "udp", 123, true, 3},
+		{"198.51.100.1", "10.0.0.2", "udp", 123, false, 0},
+		{"198.51.100.1", "", "udp", 53, false, 0},
+	}
+	for _, c := range cases {
+		flow, err := ParseFirewallFlow(c.source, c.destination, c.protocol, c.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := fw.Evaluate(flow)
+		assertEqual(t, v.Allowed, c.allowed, fmt.Sprintf("Verdict for %+v", c))
+		if c.allowed {
+			assertEqual(t, v.RuleIndex, c.rule, fmt.Sprintf("Matched rule for %+v", c))
+			assertEqual(t, v.Rule, &fw.Rules[c.rule], "Matched rule pointer")
+		}
+	}
+}
+
+func TestFirewallEvaluateServer(t *testing.T) {
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/firewalls":
+			fmt.Fprint(w, `{"data":[
+				{"id":"fw_1","type":"firewalls","attributes":{"name":"web","rules":[{"from":"ANY","to":"ANY","port":"80,443","protocol":"TCP"}]}},
+				{"id":"fw_2","type":"firewalls","attributes":{"name":"db","rules":[{"from":"203.0.113.0/24","to":"192.0.2.10","port":"5432","protocol":"TCP"}]}}
+			]}`)
+		case "/firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":[{"id":"fwasg_1","type":"firewall_server","attributes":{"server":{"id":"sv_2"}}}]}`)
+		case "/firewalls/fw_2/assignments":
+			fmt.Fprint(w, `{"data":[{"id":"fwasg_2","type":"firewall_server","attributes":{"server":{"id":"sv_1"}}}]}`)
+		case "/servers/sv_1":
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"primary_ipv4":"192.0.2.10"}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	})
+
+	flow, _ := ParseFirewallFlow("203.0.113.5", "", "tcp", 5432)
+	v, err := c.Firewalls.EvaluateServer("sv_1", flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, v.Allowed, true, "Verdict")
+	assertEqual(t, v.Firewall.ID, "fw_2", "Matched firewall")
+
+	// fw_1 allows HTTP but isn't assigned to sv_1
+	flow, _ = ParseFirewallFlow("203.0.113.5", "", "tcp", 80)
+	v, err = c.Firewalls.EvaluateServer("sv_1", flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, v.String(), "deny: no rule matched", "Verdict")
+
+	// sv_3 has no firewall, its traffic isn't filtered
+	v, err = c.Firewalls.EvaluateServer("sv_3", FirewallFlow{Source: flow.Source, Destination: flow.Source, Port: 80, Protocol: "TCP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, v.Allowed, true, "Unfiltered verdict")
+	assertEqual(t, v.Unfiltered, true, "Unfiltered")
+	assertEqual(t, v.String(), "allow: no firewall assigned", "Verdict")
+}
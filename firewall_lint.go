@@ -0,0 +1,184 @@
+package latitude
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// FirewallLintKind is the kind of problem a firewall lint finding reports
+type FirewallLintKind string
+
+const (
+	// FirewallLintInvalid is a rule that fails validation
+	FirewallLintInvalid FirewallLintKind = "invalid"
+	// FirewallLintShadowed is a rule fully covered by an earlier rule, so it
+	// never is the rule that matches
+	FirewallLintShadowed FirewallLintKind = "shadowed"
+	// FirewallLintRedundant is a rule fully covered by a later rule
+	FirewallLintRedundant FirewallLintKind = "redundant"
+	// FirewallLintMergeable is a set of rules that can be written as one
+	FirewallLintMergeable FirewallLintKind = "mergeable"
+	// FirewallLintRisky is a rule opening an administrative port to anyone
+	FirewallLintRisky FirewallLintKind = "risky"
+)
+
+// FirewallLintSeverity is how serious a firewall lint finding is
+type FirewallLintSeverity string
+
+const (
+	FirewallLintInfo     FirewallLintSeverity = "info"
+	FirewallLintWarning  FirewallLintSeverity = "warning"
+	FirewallLintCritical FirewallLintSeverity = "critical"
+)
+
+// FirewallLintFinding is a problem found in a list of firewall rules. Rules
+// holds the indexes of the rules involved.
+type FirewallLintFinding struct {
+	Kind     FirewallLintKind
+	Severity FirewallLintSeverity
+	Rules    []int
+	Message  string
+}
+
+func (f FirewallLintFinding) String() string {
+	return fmt.Sprintf("%s %s %v: %s", f.Severity, f.Kind, f.Rules, f.Message)
+}
+
+// FirewallAdminPorts are the ports reported as risky when open to any
+// source, with the service they usually run
+var FirewallAdminPorts = map[uint16]string{
+	22:    "SSH",
+	23:    "Telnet",
+	2375:  "Docker",
+	3306:  "MySQL",
+	3389:  "RDP",
+	5432:  "PostgreSQL",
+	5900:  "VNC",
+	6379:  "Redis",
+	9200:  "Elasticsearch",
+	11211: "Memcached",
+	27017: "MongoDB",
+}
+
+// isWorld reports whether the prefix matches any address of its family
+func isWorld(p netip.Prefix) bool {
+	return !p.IsValid() || p.Bits() == 0
+}
+
+// LintFirewallRules reports invalid, shadowed, redundant, mergeable and risky
+// rules. Default rules are taken into account when looking for covered
+// rules but are not reported themselves, as they are managed by the API.
+func LintFirewallRules(rules []FirewallRule) []FirewallLintFinding {
+	var findings []FirewallLintFinding
+	add := func(kind FirewallLintKind, severity FirewallLintSeverity, msg string, rules ...int) {
+		findings = append(findings, FirewallLintFinding{Kind: kind, Severity: severity, Rules: rules, Message: msg})
+	}
+
+	parsed := make([]*parsedFirewallRule, len(rules))
+	for i, r := range rules {
+		p, err := parseFirewallRule(r)
+		if err != nil {
+			if !r.Default {
+				add(FirewallLintInvalid, FirewallLintCritical, err.Error(), i)
+			}
+			continue
+		}
+		parsed[i] = &p
+	}
+
+	for i, a := range parsed {
+		if a == nil || rules[i].Default {
+			continue
+		}
+		if isWorld(a.from) {
+			if a.ports == nil {
+				add(FirewallLintRisky, FirewallLintCritical, "every port is open to any source", i)
+			} else {
+				var open []string
+				for _, port := range sortedAdminPorts() {
+					if portsCover(a.ports, []portRange{{port, port}}) {
+						open = append(open, fmt.Sprintf("%s (%d)", FirewallAdminPorts[port], port))
+					}
+				}
+				if len(open) > 0 {
+					add(FirewallLintRisky, FirewallLintCritical, strings.Join(open, ", ")+" open to any source", i)
+				}
+			}
+		}
+
+		covered := false
+		for j, b := range parsed {
+			if j == i || b == nil || !b.covers(*a) {
+				continue
+			}
+			// of two identical rules only the later one is reported
+			if j < i {
+				add(FirewallLintShadowed, FirewallLintWarning, fmt.Sprintf("covered by earlier rule %d", j), i, j)
+			} else if !a.covers(*b) {
+				add(FirewallLintRedundant, FirewallLintWarning, fmt.Sprintf("covered by later rule %d", j), i, j)
+			} else {
+				continue
+			}
+			covered = true
+			break
+		}
+		if covered {
+			continue
+		}
+
+		for j := i + 1; j < len(parsed); j++ {
+			b := parsed[j]
+			if b == nil || rules[j].Default || a.covers(*b) || b.covers(*a) {
+				continue
+			}
+			if msg, ok := mergeFirewallRules(*a, *b); ok {
+				add(FirewallLintMergeable, FirewallLintInfo, msg, i, j)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Rules[0] < findings[j].Rules[0] })
+	return findings
+}
+
+// mergeFirewallRules describes the rule a and b can be merged into, if any:
+// rules differing only by their ports, or only by sibling source prefixes
+func mergeFirewallRules(a, b parsedFirewallRule) (string, bool) {
+	if a.protocol != b.protocol || a.to != b.to {
+		return "", false
+	}
+	if a.from == b.from && a.ports != nil && b.ports != nil {
+		merged := mergePortRanges(append(append([]portRange{}, a.ports...), b.ports...))
+		return fmt.Sprintf("can be merged into a single rule on port %s", formatFirewallPorts(merged)), true
+	}
+	if formatFirewallPorts(a.ports) == formatFirewallPorts(b.ports) && a.from.IsValid() && b.from.IsValid() &&
+		a.from.Bits() == b.from.Bits() && a.from.Bits() > 0 && a.from.Addr().Is4() == b.from.Addr().Is4() {
+		parent, _ := a.from.Addr().Prefix(a.from.Bits() - 1)
+		if parent.Contains(b.from.Addr()) {
+			return fmt.Sprintf("can be merged into a single rule from %s", formatFirewallAddress(parent)), true
+		}
+	}
+	return "", false
+}
+
+func sortedAdminPorts() []uint16 {
+	ports := make([]uint16, 0, len(FirewallAdminPorts))
+	for p := range FirewallAdminPorts {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// Lint reports problems in the rules of the firewall, see LintFirewallRules
+func (f *Firewall) Lint() []FirewallLintFinding {
+	return LintFirewallRules(f.Rules)
+}
+
+// Lint reports problems in the rules of the request before it is sent, see
+// LintFirewallRules
+func (r *FirewallCreateRequest) Lint() []FirewallLintFinding {
+	return LintFirewallRules(r.Data.Attributes.Rules)
+}
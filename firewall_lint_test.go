@@ -0,0 +1,44 @@
+package latitude
+
+import (
+	"testing"
+)
+
+func TestLintFirewallRules(t *testing.T) {
+	rules := []FirewallRule{
+		{From: "ANY", To: "ANY", Port: "22", Protocol: "TCP"},
+		{From: "10.0.0.0/8", To: "ANY", Port: "80", Protocol: "TCP"},
+		{From: "10.1.0.0/16", To: "ANY", Port: "80", Protocol: "TCP"},
+		{From: "192.168.0.0/24", To: "ANY", Port: "443", Protocol: "TCP"},
+		{From: "192.168.0.0/24", To: "ANY", Port: "8443", Protocol: "TCP"},
+		{From: "172.16.0.0/24", To: "ANY", Port: "53", Protocol: "UDP"},
+		{From: "172.16.1.0/24", To: "ANY", Port: "53", Protocol: "UDP"},
+		{From: "198.51.100.7", To: "ANY", Port: "1-1024", Protocol: "UDP"},
+		{From: "198.51.100.0/24", To: "ANY", Port: "ANY", Protocol: "UDP"},
+		{From: "10.0.0.0/33", To: "ANY", Port: "80", Protocol: "TCP"},
+		{From: "ANY", To: "ANY", Port: "22", Protocol: "TCP", Default: true},
+	}
+
+	expected := []FirewallLintFinding{
+		{Kind: FirewallLintRisky, Severity: FirewallLintCritical, Rules: []int{0}, Message: "SSH (22) open to any source"},
+		{Kind: FirewallLintShadowed, Severity: FirewallLintWarning, Rules: []int{2, 1}, Message: "covered by earlier rule 1"},
+		{Kind: FirewallLintMergeable, Severity: FirewallLintInfo, Rules: []int{3, 4}, Message: "can be merged into a single rule on port 443,8443"},
+		{Kind: FirewallLintMergeable, Severity: FirewallLintInfo, Rules: []int{5, 6}, Message: "can be merged into a single rule from 172.16.0.0/23"},
+		{Kind: FirewallLintRedundant, Severity: FirewallLintWarning, Rules: []int{7, 8}, Message: "covered by later rule 8"},
+		{Kind: FirewallLintInvalid, Severity: FirewallLintCritical, Rules: []int{9}, Message: `validation failed: rule.from: invalid CIDR "10.0.0.0/33"`},
+	}
+
+	findings := LintFirewallRules(rules)
+	// the user SSH rule and the default one cover each other, the default
+	// rule itself is never reported
+	assertEqual(t, len(findings), len(expected), "Findings")
+	for i, f := range expected {
+		assertEqual(t, findings[i].Kind, f.Kind, "Finding kind")
+		assertEqual(t, findings[i].Severity, f.Severity, "Finding severity")
+		assertEqual(t, findings[i].Message, f.Message, "Finding message")
+		assertEqual(t, len(findings[i].Rules), len(f.Rules), "Finding rules")
+		for j := range f.Rules {
+			assertEqual(t, findings[i].Rules[j], f.Rules[j], "Finding rule index")
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package latitude
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FirewallPreset is a named rule template. Rule fields may reference
+// parameters as "${name}": a From or To field that is a single reference
+// expands to one rule per value, and references in Port are replaced by the
+// values joined as a port list.
+type FirewallPreset struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+
+	// Params are the parameters of the preset with their default values. A
+	// parameter without defaults is required.
+	Params map[string][]string `yaml:"params"`
+
+	Rules []FirewallRule `yaml:"rules"`
+}
+
+// FirewallPresetParams are the values given to the parameters of a preset
+type FirewallPresetParams map[string][]string
+
+var firewallPresetParamRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+var builtinFirewallPresets = []FirewallPreset{
+	{
+		Name:        "ssh",
+		Description: "SSH from the given sources, such as bastion hosts",
+		Params:      map[string][]string{"sources": nil, "port": {"22"}},
+		Rules:       []FirewallRule{{From: "${sources}", To: FirewallAny, Port: "${port}", Protocol: string(FirewallProtocolTCP)}},
+	},
+	{
+		Name:        "web",
+		Description: "HTTP and HTTPS, from anywhere by default",
+		Params:      map[string][]string{"sources": {FirewallAny}, "ports": {"80", "443"}},
+		Rules:       []FirewallRule{{From: "${sources}", To: FirewallAny, Port: "${ports}", Protocol: string(FirewallProtocolTCP)}},
+	},
+	{
+		Name:        "monitoring",
+		Description: "Prometheus exporters scraped from the given sources",
+		Params:      map[string][]string{"sources": nil, "ports": {"9100"}},
+		Rules:       []FirewallRule{{From: "${sources}", To: FirewallAny, Port: "${ports}", Protocol: string(FirewallProtocolTCP)}},
+	},
+	{
+		Name:        "dns",
+		Description: "DNS over TCP and UDP from the given sources",
+		Params:      map[string][]string{"sources": nil},
+		Rules: []FirewallRule{
+			{From: "${sources}", To: FirewallAny, Port: "53", Protocol: string(FirewallProtocolUDP)},
+			{From: "${sources}", To: FirewallAny, Port: "53", Protocol: string(FirewallProtocolTCP)},
+		},
+	},
+}
+
+// FirewallPresets returns the built-in presets: "ssh", "web",
+// "monitoring" and "dns"
+func FirewallPresets() []FirewallPreset {
+	presets := make([]FirewallPreset, len(builtinFirewallPresets))
+	copy(presets, builtinFirewallPresets)
+	return presets
+}
+
+// LoadFirewallPresets decodes presets from a YAML document with a top level
+// "presets" list
+func LoadFirewallPresets(r io.Reader) ([]FirewallPreset, error) {
+	var doc struct {
+		Presets []FirewallPreset `yaml:"presets"`
+	}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	names := map[string]bool{}
+	for i, p := range doc.Presets {
+		field := fmt.Sprintf("presets[%d]", i)
+		if p.Name == "" {
+			verr.add(field+".name", "name is required")
+		} else if names[p.Name] {
+			verr.add(field+".name", "preset %q is defined more than once", p.Name)
+		}
+		names[p.Name] = true
+		for j, r := range p.Rules {
+			for _, ref := range firewallPresetParamRegexp.FindAllStringSubmatch(r.From+r.To+r.Port, -1) {
+				if _, ok := p.Params[ref[1]]; !ok {
+					verr.add(fmt.Sprintf("%s.rules[%d]", field, j), "undeclared parameter %q", ref[1])
+				}
+			}
+		}
+	}
+	return doc.Presets, verr.errOrNil()
+}
+
+// LoadFirewallPresetsFile decodes the YAML presets document at path
+func LoadFirewallPresetsFile(path string) ([]FirewallPreset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadFirewallPresets(f)
+}
+
+// Expand returns the rules of the preset for the given parameters
+func (p FirewallPreset) Expand(params FirewallPresetParams) ([]FirewallRule, error) {
+	verr := &ValidationError{}
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string][]string{}
+	for _, name := range names {
+		defaults := p.Params[name]
+		v, ok := params[name]
+		if !ok || len(v) == 0 {
+			v = defaults
+		}
+		if len(v) == 0 {
+			verr.add(p.Name, "parameter %q is required", name)
+		}
+		values[name] = v
+	}
+	var unknown []string
+	for name := range params {
+		if _, ok := p.Params[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		verr.add(p.Name, "unknown parameter %q", name)
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+
+	substitute := func(field string) string {
+		return firewallPresetParamRegexp.ReplaceAllStringFunc(field, func(ref string) string {
+			return strings.Join(values[ref[2:len(ref)-1]], ",")
+		})
+	}
+	// addresses expand to one rule per value when the field is a single
+	// reference, ports are joined into a port list
+	addresses := func(field string) []string {
+		if m := firewallPresetParamRegexp.FindStringSubmatch(field); m != nil && m[0] == field {
+			return values[m[1]]
+		}
+		return []string{substitute(field)}
+	}
+
+	var rules []FirewallRule
+	for _, tmpl := range p.Rules {
+		port := substitute(tmpl.Port)
+		for _, from := range addresses(tmpl.From) {
+			for _, to := range addresses(tmpl.To) {
+				rules = append(rules, FirewallRule{From: from, To: to, Port: port, Protocol: tmpl.Protocol})
+			}
+		}
+	}
+	return rules, nil
+}
+
+// FirewallRuleBuilder composes firewall rules from presets and single rules.
+// Errors are collected and returned by Rules, so calls can be chained.
+type FirewallRuleBuilder struct {
+	presets map[string]FirewallPreset
+	rules   []FirewallRule
+	errs    []Violation
+}
+
+// NewFirewallRuleBuilder returns a builder knowing the built-in presets and
+// the given ones, which replace built-in presets of the same name
+func NewFirewallRuleBuilder(presets ...FirewallPreset) *FirewallRuleBuilder {
+	b := &FirewallRuleBuilder{presets: map[string]FirewallPreset{}}
+	for _, p := range builtinFirewallPresets {
+		b.presets[p.Name] = p
+	}
+	for _, p := range presets {
+		b.presets[p.Name] = p
+	}
+	return b
+}
+
+// Preset adds the rules of the named preset
+func (b *FirewallRuleBuilder) Preset(name string, params FirewallPresetParams) *FirewallRuleBuilder {
+	p, ok := b.presets[name]
+	if !ok {
+		b.errs = append(b.errs, Violation{Field: name, Message: "unknown preset"})
+		return b
+	}
+	rules, err := p.Expand(params)
+	if verr, ok := err.(*ValidationError); ok {
+		b.errs = append(b.errs, verr.Violations...)
+		return b
+	}
+	b.rules = append(b.rules, rules...)
+	return b
+}
+
+// Allow adds rules as they are
+func (b *FirewallRuleBuilder) Allow(rules ...FirewallRule) *FirewallRuleBuilder {
+	b.rules = append(b.rules, rules...)
+	return b
+}
+
+// Rules returns the normalized rules in the order they were added, without
+// duplicates. Every problem met while building is reported in a
+// *ValidationError.
+func (b *FirewallRuleBuilder) Rules() ([]FirewallRule, error) {
+	verr := &ValidationError{Violations: append([]Violation(nil), b.errs...)}
+	rules, err := NormalizeFirewallRules(b.rules)
+	if e, ok := err.(*ValidationError); ok {
+		verr.Violations = append(verr.Violations, e.Violations...)
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var unique []FirewallRule
+	for _, r := range rules {
+		if k := firewallRuleKey(r); !seen[k] {
+			seen[k] = true
+			unique = append(unique, r)
+		}
+	}
+	return unique, nil
+}
+
+// CreateRequest returns a request creating a firewall with the built rules
+func (b *FirewallRuleBuilder) CreateRequest(name, project string) (*FirewallCreateRequest, error) {
+	rules, err := b.Rules()
+	if err != nil {
+		return nil, err
+	}
+	return &FirewallCreateRequest{
+		Data: FirewallCreateData{
+			Type:       "firewalls",
+			Attributes: FirewallCreateAttributes{Name: name, Project: project, Rules: rules},
+		},
+	}, nil
+}
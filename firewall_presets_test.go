@@ -0,0 +1,87 @@
+package latitude
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testFirewallPresets = `
+presets:
+  - name: postgres
+    description: PostgreSQL from the app servers
+    params:
+      sources:
+      port: [5432]
+    rules:
+      - from: ${sources}
+        to: ANY
+        port: ${port}
+        protocol: TCP
+  - name: ssh
+    params:
+      sources: [10.10.0.0/24]
+    rules:
+      - {from: "${sources}", to: ANY, port: 2222, protocol: tcp}
+`
+
+func TestFirewallRuleBuilder(t *testing.T) {
+	presets, err := LoadFirewallPresets(strings.NewReader(testFirewallPresets))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewFirewallRuleBuilder().
+		Preset("ssh", FirewallPresetParams{"sources": {"10.0.0.0/24", "10.0.1.0/24"}}).
+		Preset("web", nil).
+		Preset("monitoring", FirewallPresetParams{"sources": {"10.0.5.10"}, "ports": {"9100", "9256"}}).
+		Allow(FirewallRule{From: "ANY", To: "ANY", Port: "443,80", Protocol: "tcp"}).
+		CreateRequest("baseline", "proj_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRules(t, req.Data.Attributes.Rules, []FirewallRule{
+		{From: "10.0.0.0/24", To: "ANY", Port: "22", Protocol: "TCP"},
+		{From: "10.0.1.0/24", To: "ANY", Port: "22", Protocol: "TCP"},
+		{From: "ANY", To: "ANY", Port: "80,443", Protocol: "TCP"},
+		{From: "10.0.5.10", To: "ANY", Port: "9100,9256", Protocol: "TCP"},
+	})
+	assertEqual(t, req.Data.Attributes.Project, "proj_1", "Request project")
+
+	// custom presets replace built-in ones of the same name
+	rules, err := NewFirewallRuleBuilder(presets...).
+		Preset("ssh", nil).
+		Preset("postgres", FirewallPresetParams{"sources": {"10.0.2.0/24"}}).
+		Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRules(t, rules, []FirewallRule{
+		{From: "10.10.0.0/24", To: "ANY", Port: "2222", Protocol: "TCP"},
+		{From: "10.0.2.0/24", To: "ANY", Port: "5432", Protocol: "TCP"},
+	})
+
+	_, err = NewFirewallRuleBuilder().
+		Preset("ssh", nil).
+		Preset("web", FirewallPresetParams{"source": {"ANY"}}).
+		Preset("ftp", nil).
+		Allow(FirewallRule{From: "ANY", To: "ANY", Port: "80-", Protocol: "TCP"}).
+		Rules()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	assertEqual(t, len(verr.Violations), 4, "Violations")
+}
+
+func TestLoadFirewallPresetsUndeclaredParam(t *testing.T) {
+	_, err := LoadFirewallPresets(strings.NewReader(`
+presets:
+  - name: app
+    rules:
+      - {from: "${sources}", to: ANY, port: 8080, protocol: TCP}
+`))
+	if err == nil {
+		t.Fatal("Expected an error for an undeclared parameter")
+	}
+}
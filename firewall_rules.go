@@ -0,0 +1,262 @@
+package latitude
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FirewallProtocol is the protocol a firewall rule applies to
+type FirewallProtocol string
+
+const (
+	FirewallProtocolTCP FirewallProtocol = "TCP"
+	FirewallProtocolUDP FirewallProtocol = "UDP"
+)
+
+// FirewallAny matches any address or port in a firewall rule
+const FirewallAny = "ANY"
+
+// portRange is an inclusive range of ports
+type portRange struct {
+	lo, hi uint16
+}
+
+func (r portRange) String() string {
+	if r.lo == r.hi {
+		return strconv.Itoa(int(r.lo))
+	}
+	return fmt.Sprintf("%d-%d", r.lo, r.hi)
+}
+
+// parseFirewallAddress parses an address, a CIDR or "any". The prefix is
+// invalid for "any".
+func parseFirewallAddress(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, FirewallAny) {
+		return netip.Prefix{}, nil
+	}
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil || a.Zone() != "" {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", s)
+	}
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// formatFirewallAddress formats an address parsed by parseFirewallAddress,
+// with host prefixes as plain addresses
+func formatFirewallAddress(p netip.Prefix) string {
+	switch {
+	case !p.IsValid():
+		return FirewallAny
+	case p.IsSingleIP():
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+// parseFirewallPorts parses a port, a range such as "3000-4000", a comma
+// separated list of both, or "any". The ranges are sorted and merged, and nil
+// for "any".
+func parseFirewallPorts(s string) ([]portRange, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, FirewallAny) {
+		return nil, nil
+	}
+	if s == "" {
+		return nil, fmt.Errorf("port is required, use %q for every port", FirewallAny)
+	}
+
+	var ranges []portRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err := parsePort(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		to, err := parsePort(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid port range %q, start is after end", part)
+		}
+		ranges = append(ranges, portRange{from, to})
+	}
+	return mergePortRanges(ranges), nil
+}
+
+func parsePort(s string) (uint16, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(n), nil
+}
+
+// mergePortRanges sorts the ranges and merges those overlapping or adjacent
+func mergePortRanges(ranges []portRange) []portRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].lo < ranges[j].lo })
+	var merged []portRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && int(r.lo) <= int(merged[n-1].hi)+1 {
+			if r.hi > merged[n-1].hi {
+				merged[n-1].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func formatFirewallPorts(ranges []portRange) string {
+	if ranges == nil {
+		return FirewallAny
+	}
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// normalize validates the rule and returns its canonical form, recording
+// violations on fields prefixed with field
+func (r FirewallRule) normalize(field string, verr *ValidationError) FirewallRule {
+	n := r
+
+	from, err := parseFirewallAddress(r.From)
+	if err != nil {
+		verr.add(field+".from", "%s", err)
+	} else {
+		n.From = formatFirewallAddress(from)
+	}
+	to, err := parseFirewallAddress(r.To)
+	if err != nil {
+		verr.add(field+".to", "%s", err)
+	} else {
+		n.To = formatFirewallAddress(to)
+	}
+	if from.IsValid() && to.IsValid() && from.Addr().Is4() != to.Addr().Is4() {
+		verr.add(field, "from %s and to %s are not of the same IP family", n.From, n.To)
+	}
+
+	ports, err := parseFirewallPorts(r.Port)
+	if err != nil {
+		verr.add(field+".port", "%s", err)
+	} else {
+		n.Port = formatFirewallPorts(ports)
+	}
+
+	switch p := FirewallProtocol(strings.ToUpper(strings.TrimSpace(r.Protocol))); p {
+	case FirewallProtocolTCP, FirewallProtocolUDP:
+		n.Protocol = string(p)
+	default:
+		verr.add(field+".protocol", "invalid protocol %q, expected %s or %s", r.Protocol, FirewallProtocolTCP, FirewallProtocolUDP)
+	}
+
+	return n
+}
+
+// Normalize validates the rule and returns its canonical form: "ANY" in
+// upper case, addresses in their shortest form, CIDRs without host bits,
+// host CIDRs as plain addresses, port lists sorted and merged, and the
+// protocol in upper case. Violations are returned in a *ValidationError.
+func (r FirewallRule) Normalize() (FirewallRule, error) {
+	verr := &ValidationError{}
+	n := r.normalize("rule", verr)
+	return n, verr.errOrNil()
+}
+
+// NormalizeFirewallRules validates the rules and returns their canonical
+// form, see FirewallRule.Normalize. Default rules are managed by the API and
+// kept as they are. Every violation is reported, on fields such as
+// "rules[2].port".
+func NormalizeFirewallRules(rules []FirewallRule) ([]FirewallRule, error) {
+	verr := &ValidationError{}
+	normalized := make([]FirewallRule, len(rules))
+	for i, r := range rules {
+		if r.Default {
+			normalized[i] = r
+			continue
+		}
+		normalized[i] = r.normalize(fmt.Sprintf("rules[%d]", i), verr)
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// parsedFirewallRule is a valid rule in a form that can be compared. An
+// invalid prefix means any address and nil ports any port.
+type parsedFirewallRule struct {
+	from, to netip.Prefix
+	ports    []portRange
+	protocol FirewallProtocol
+}
+
+func parseFirewallRule(r FirewallRule) (parsedFirewallRule, error) {
+	n, err := r.Normalize()
+	if err != nil {
+		return parsedFirewallRule{}, err
+	}
+	p := parsedFirewallRule{protocol: FirewallProtocol(n.Protocol)}
+	p.from, _ = parseFirewallAddress(n.From)
+	p.to, _ = parseFirewallAddress(n.To)
+	p.ports, _ = parseFirewallPorts(n.Port)
+	return p, nil
+}
+
+// prefixCovers reports whether every address of b is in a
+func prefixCovers(a, b netip.Prefix) bool {
+	if !a.IsValid() {
+		return true
+	}
+	if !b.IsValid() {
+		return false
+	}
+	return a.Addr().Is4() == b.Addr().Is4() && a.Bits() <= b.Bits() && a.Contains(b.Addr())
+}
+
+// portsCover reports whether every port of b is in a
+func portsCover(a, b []portRange) bool {
+	if a == nil {
+		return true
+	}
+	if b == nil {
+		return false
+	}
+	for _, rb := range b {
+		covered := false
+		for _, ra := range a {
+			if ra.lo <= rb.lo && rb.hi <= ra.hi {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether every flow matched by b is matched by r
+func (r parsedFirewallRule) covers(b parsedFirewallRule) bool {
+	return r.protocol == b.protocol && prefixCovers(r.from, b.from) && prefixCovers(r.to, b.to) && portsCover(r.ports, b.ports)
+}
@@ -0,0 +1,72 @@
+package latitude
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestFirewallRuleNormalize(t *testing.T) {
+	cases := []struct {
+		rule     FirewallRule
+		expected FirewallRule
+	}{
+		{
+			FirewallRule{From: "any", To: "10.0.0.5/8", Port: "443, 80,81-90", Protocol: "tcp"},
+			FirewallRule{From: "ANY", To: "10.0.0.0/8", Port: "80-90,443", Protocol: "TCP"},
+		},
+		{
+			FirewallRule{From: "2001:DB8:0:0::1/128", To: "2001:db8::/32", Port: "22-22", Protocol: "UDP"},
+			FirewallRule{From: "2001:db8::1", To: "2001:db8::/32", Port: "22", Protocol: "UDP"},
+		},
+		{
+			FirewallRule{From: " 192.168.1.1 ", To: "ANY", Port: "Any", Protocol: "udp"},
+			FirewallRule{From: "192.168.1.1", To: "ANY", Port: "ANY", Protocol: "UDP"},
+		},
+	}
+	for _, c := range cases {
+		n, err := c.rule.Normalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, n, c.expected, "Normalized rule")
+	}
+}
+
+func TestNormalizeFirewallRulesViolations(t *testing.T) {
+	rules := []FirewallRule{
+		{From: "ANY", To: "ANY", Port: "80", Protocol: "TCP"},
+		{From: "10.0.0.0/33", To: "2001:db8::1", Port: "80-", Protocol: "ICMP"},
+		{From: "10.0.0.1", To: "2001:db8::1", Port: "70000", Protocol: "TCP"},
+		{From: "", To: "ANY", Port: "90-80", Protocol: "TCP", Default: false},
+		{From: "whatever", Default: true},
+	}
+	_, err := NormalizeFirewallRules(rules)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	fields := []string{
+		"rules[1].from", "rules[1].port", "rules[1].protocol",
+		"rules[2]", "rules[2].port",
+		"rules[3].from", "rules[3].port",
+	}
+	assertEqual(t, len(verr.Violations), len(fields), "Violations")
+	for i, f := range fields {
+		assertEqual(t, verr.Violations[i].Field, f, "Violation field")
+	}
+}
+
+func TestFirewallCreateValidatesRules(t *testing.T) {
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	})
+	_, _, err := c.Firewalls.Create(&FirewallCreateRequest{Data: FirewallCreateData{Attributes: FirewallCreateAttributes{
+		Name:  "web",
+		Rules: []FirewallRule{{From: "ANY", To: "ANY", Port: "80-", Protocol: "TCP"}},
+	}}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+}
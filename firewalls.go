@@ -1,6 +1,7 @@
 package latitude
 
 import (
+	"encoding/json"
 	"path"
 )
 
@@ -16,6 +17,10 @@ type FirewallService interface {
 	ListAssignments(firewallID string, listOpt *ListOptions) ([]FirewallAssignment, *Response, error)
 	CreateAssignment(firewallID string, request *FirewallAssignmentCreateRequest) (*FirewallAssignment, *Response, error)
 	DeleteAssignment(firewallID string, assignmentID string) (*Response, error)
+	ServerFirewalls(serverID string) ([]Firewall, error)
+	EvaluateServer(serverID string, flow FirewallFlow) (*FirewallVerdict, error)
+	Sync(firewallID string, desired []FirewallRule) (*Firewall, *FirewallRuleDiff, error)
+	EnsureAssignments(firewallID string, selector FirewallServerSelector, opts *EnsureAssignmentsOptions) (FirewallAssignmentReports, error)
 }
 
 // FirewallRule represents a rule in a firewall
@@ -44,7 +49,8 @@ type Firewall struct {
 
 // FirewallServiceOp implements FirewallService
 type FirewallServiceOp struct {
-	client requestDoer
+	client  requestDoer
+	servers ServerService
 }
 
 // FirewallData represents the data structure returned by the API
@@ -103,12 +109,25 @@ type FirewallUpdateData struct {
 	Attributes FirewallUpdateAttributes `json:"attributes"`
 }
 
-// FirewallUpdateAttributes represents the attributes for updating a firewall
+// FirewallUpdateAttributes represents the attributes for updating a firewall.
+// A nil Rules leaves the rules untouched, an empty non-nil one removes them all.
 type FirewallUpdateAttributes struct {
 	Name  string         `json:"name,omitempty"`
 	Rules []FirewallRule `json:"rules,omitempty"`
 }
 
+// MarshalJSON sends an empty non-nil Rules, which omitempty would drop
+func (a FirewallUpdateAttributes) MarshalJSON() ([]byte, error) {
+	attrs := struct {
+		Name  string          `json:"name,omitempty"`
+		Rules *[]FirewallRule `json:"rules,omitempty"`
+	}{Name: a.Name}
+	if a.Rules != nil {
+		attrs.Rules = &a.Rules
+	}
+	return json.Marshal(attrs)
+}
+
 // FirewallAssignment represents a firewall assignment to a server
 type FirewallAssignment struct {
 	ID     string `json:"id"`
@@ -227,7 +246,8 @@ func (s *FirewallServiceOp) Get(firewallID string, opts *GetOptions) (*Firewall,
 	return &flatFirewall, resp, err
 }
 
-// Create creates a new firewall
+// Create creates a new firewall. The rules are validated and normalized
+// first, see NormalizeFirewallRules.
 func (s *FirewallServiceOp) Create(createRequest *FirewallCreateRequest) (*Firewall, *Response, error) {
 	firewall := new(FirewallGetResponse)
 
@@ -236,6 +256,12 @@ func (s *FirewallServiceOp) Create(createRequest *FirewallCreateRequest) (*Firew
 		createRequest.Data.Type = "firewalls"
 	}
 
+	rules, err := NormalizeFirewallRules(createRequest.Data.Attributes.Rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	createRequest.Data.Attributes.Rules = rules
+
 	resp, err := s.client.DoRequest("POST", firewallBasePath, createRequest, firewall)
 	if err != nil {
 		return nil, resp, err
@@ -245,7 +271,8 @@ func (s *FirewallServiceOp) Create(createRequest *FirewallCreateRequest) (*Firew
 	return &flatFirewall, resp, err
 }
 
-// Update updates a firewall
+// Update updates a firewall. The rules are validated and normalized first,
+// see NormalizeFirewallRules.
 func (s *FirewallServiceOp) Update(firewallID string, updateRequest *FirewallUpdateRequest) (*Firewall, *Response, error) {
 	apiPath := path.Join(firewallBasePath, firewallID)
 	firewall := new(FirewallGetResponse)
@@ -255,6 +282,14 @@ func (s *FirewallServiceOp) Update(firewallID string, updateRequest *FirewallUpd
 		updateRequest.Data.Type = "firewalls"
 	}
 
+	if updateRequest.Data.Attributes.Rules != nil {
+		rules, err := NormalizeFirewallRules(updateRequest.Data.Attributes.Rules)
+		if err != nil {
+			return nil, nil, err
+		}
+		updateRequest.Data.Attributes.Rules = rules
+	}
+
 	resp, err := s.client.DoRequest("PATCH", apiPath, updateRequest, firewall)
 	if err != nil {
 		return nil, resp, err
@@ -4,4 +4,4 @@ go 1.22.4
 
 require gopkg.in/dnaeon/go-vcr.v3 v3.1.2
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
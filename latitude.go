@@ -41,6 +41,10 @@ type meta struct {
 // Response is the http response from api calls
 type Response struct {
 	*http.Response
+
+	// FromCache is set when the API answered 304 Not Modified and the body
+	// was decoded from the previous response, see EnableConditionalRequests
+	FromCache bool
 }
 
 // Href is an API link
@@ -74,6 +78,9 @@ func (r *ErrorResponse) Error() string {
 type Client struct {
 	client        *http.Client
 	debug         bool
+	budget        *budgetGuard
+	catalog       *catalogCache
+	conditional   *conditionalCache
 	BaseURL       *url.URL
 	UserAgent     string
 	ConsumerToken string
@@ -95,6 +102,7 @@ type Client struct {
 	Roles            RoleService
 	Users            UserService
 	Firewalls        FirewallService
+	DeployConfigs    DeployConfigService
 }
 
 type requestDoer interface {
@@ -153,11 +161,26 @@ func (c *Client) NewRequest(method, path string, body interface{}) (*http.Reques
 
 // Do executes the http request
 func (c *Client) Do(req *http.Request, v interface{}) (*Response, error) {
+	c.conditional.prepare(req)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode == http.StatusNotModified && req.Method == http.MethodGet {
+		if _, ok := c.conditional.lookup(req); !ok {
+			// the remembered response was dropped while the request was in
+			// flight, or the caller set the validators, ask for the body
+			resp.Body.Close()
+			req = unconditional(req)
+			resp, err = c.client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	defer resp.Body.Close()
 
 	response := Response{Response: resp}
@@ -167,21 +190,40 @@ func (c *Client) Do(req *http.Request, v interface{}) (*Response, error) {
 	}
 	dumpDeprecation(response.Response)
 
-	err = checkResponse(resp)
-	// if the response is an error, return the ErrorResponse
-	if err != nil {
-		return &response, err
+	var body io.Reader = resp.Body
+	if resp.StatusCode == http.StatusNotModified {
+		e, ok := c.conditional.lookup(req)
+		if !ok {
+			return &response, ErrNotModifiedWithoutBody
+		}
+		response.FromCache = true
+		body = bytes.NewReader(e.body)
+	} else if c.conditional.wants(req, resp) {
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return &response, err
+		}
+		c.conditional.store(req, resp, b)
+		body = bytes.NewReader(b)
+	}
+
+	if !response.FromCache {
+		err = checkResponse(resp)
+		// if the response is an error, return the ErrorResponse
+		if err != nil {
+			return &response, err
+		}
 	}
 
 	if v != nil {
 		// if v implements the io.Writer interface, return the raw response
 		if w, ok := v.(io.Writer); ok {
-			_, err = io.Copy(w, resp.Body)
+			_, err = io.Copy(w, body)
 			if err != nil {
 				return &response, err
 			}
 		} else {
-			err = json.NewDecoder(resp.Body).Decode(v)
+			err = json.NewDecoder(body).Decode(v)
 			if err != nil {
 				return &response, err
 			}
@@ -328,22 +370,26 @@ func NewClientWithBaseURL(apiKey string, httpClient *http.Client, apiBaseURL str
 	}
 
 	c := &Client{client: httpClient, BaseURL: u, APIKey: apiKey}
+	c.budget = &budgetGuard{client: c}
+	c.catalog = &catalogCache{}
+	c.conditional = &conditionalCache{}
 	c.Projects = &ProjectServiceOp{client: c}
-	c.Servers = &ServerServiceOp{client: c}
+	c.Servers = &ServerServiceOp{client: c, budget: c.budget}
 	c.SSHKeys = &SSHKeyServiceOp{client: c}
 	c.UserData = &UserDataServiceOp{client: c}
 	c.Tags = &TagServiceOp{client: c}
 	c.Teams = &TeamServiceOp{client: c}
 	c.Bandwidth = &BandwidthServiceOp{client: c}
-	c.Plans = &PlanServiceOp{client: c}
-	c.OperatingSystems = &OperatingSystemServiceOp{client: c}
-	c.Regions = &RegionServiceOp{client: c}
+	c.Plans = &PlanServiceOp{client: c, catalog: c.catalog}
+	c.OperatingSystems = &OperatingSystemServiceOp{client: c, catalog: c.catalog}
+	c.Regions = &RegionServiceOp{client: c, catalog: c.catalog}
 	c.VirtualNetworks = &VirtualNetworkServiceOp{client: c}
 	c.VlanAssignments = &VlanAssignmentServiceOp{client: c}
 	c.Members = &MemberServiceOp{client: c}
-	c.Roles = &RoleServiceOp{client: c}
+	c.Roles = &RoleServiceOp{client: c, catalog: c.catalog}
 	c.Users = &UserServiceOp{client: c}
-	c.Firewalls = &FirewallServiceOp{client: c}
+	c.Firewalls = &FirewallServiceOp{client: c, servers: c.Servers}
+	c.DeployConfigs = &DeployConfigServiceOp{client: c}
 	c.debug = os.Getenv(debugEnvVar) != ""
 
 	return c, nil
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strings"
@@ -192,6 +193,34 @@ func setup(t *testing.T) (*Client, func()) {
 	return c, stopRecord
 }
 
+// setupMock returns a client pointed at a local test server backed by the given
+// handler, for tests that don't need the recorded API fixtures
+func setupMock(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClientWithBaseURL("test-token", srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// setupFixture returns a client replaying the recorded API fixture of the
+// named test, for tests that need realistic API data without network access
+func setupFixture(t *testing.T, name string) *Client {
+	r, stopRecord := testRecorder(t, name, recorder.ModeReplayOnly)
+	t.Cleanup(stopRecord)
+
+	httpClient := *http.DefaultClient
+	httpClient.Transport = r
+	c, err := NewClientWithBaseURL("test-token", &httpClient, baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
 func projectTeardown(c *Client) {
 	ps, _, err := c.Projects.List(nil)
 	if err != nil {
@@ -1,10 +1,22 @@
 package latitude
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 const operatingSystemBasePath = "/plans/operating_systems"
 
+// ErrOperatingSystemNotFound is returned by Get and GetBySlug when no
+// operating system matches
+var ErrOperatingSystemNotFound = errors.New("operating system not found")
+
 // OperatingSystemService interface defines available Operating Systems methods
 type OperatingSystemService interface {
 	List(listOpt *ListOptions) ([]OperatingSystem, *Response, error)
+	Get(osID string) (*OperatingSystem, *Response, error)
+	GetBySlug(slug string) (*OperatingSystem, *Response, error)
 }
 
 type OperatingSystemListResponse struct {
@@ -25,6 +37,10 @@ type OperatingSystemAttributes struct {
 	Version  string                  `json:"version"`
 	User     string                  `json:"user"`
 	Features OperatingSystemFeatures `json:"features"`
+
+	// ProvisionableOn lists the names of the plans the OS can be deployed on,
+	// such as c2.small.x86
+	ProvisionableOn []string `json:"provisionable_on"`
 }
 
 type OperatingSystemFeatures struct {
@@ -52,10 +68,34 @@ type OperatingSystem struct {
 	Rescue   bool   `json:"rescue"`
 	SshKeys  bool   `json:"ssh_keys"`
 	UserData bool   `json:"user_data"`
+
+	ProvisionableOn []string `json:"provisionable_on"`
+}
+
+// ProvisionableOnPlan reports whether the OS can be deployed on the plan. The
+// plan may be given by name (c2.small.x86) or slug (c2-small-x86). An OS that
+// doesn't list its plans is assumed to be deployable on any of them.
+func (o OperatingSystem) ProvisionableOnPlan(plan string) bool {
+	if len(o.ProvisionableOn) == 0 {
+		return true
+	}
+	key := planKey(plan)
+	for _, p := range o.ProvisionableOn {
+		if planKey(p) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// planKey normalizes a plan name or slug so that both spellings compare equal
+func planKey(plan string) string {
+	return strings.ToLower(strings.NewReplacer(".", "-", "_", "-").Replace(plan))
 }
 
 type OperatingSystemServiceOp struct {
-	client requestDoer
+	client  requestDoer
+	catalog *catalogCache
 }
 
 func NewFlatOperatingSystem(osd OperatingSystemData) OperatingSystem {
@@ -71,6 +111,7 @@ func NewFlatOperatingSystem(osd OperatingSystemData) OperatingSystem {
 		osd.Attributes.Features.Rescue,
 		osd.Attributes.Features.SshKeys,
 		osd.Attributes.Features.UserData,
+		osd.Attributes.ProvisionableOn,
 	}
 }
 
@@ -82,8 +123,17 @@ func NewFlatOperatingSystemList(osd []OperatingSystemData) []OperatingSystem {
 	return res
 }
 
-// List returns a list of Operating Systems
-func (os *OperatingSystemServiceOp) List(opts *ListOptions) (operatingSystems []OperatingSystem, resp *Response, err error) {
+// List returns a list of Operating Systems. Unfiltered lists are served from the catalog
+// cache when it is enabled, see Client.EnableCatalogCache.
+func (os *OperatingSystemServiceOp) List(opts *ListOptions) ([]OperatingSystem, *Response, error) {
+	if opts == nil && os.catalog.isEnabled() {
+		return catalogList(os.catalog, CatalogOperatingSystems, func() ([]OperatingSystem, *Response, error) { return os.list(nil) })
+	}
+	return os.list(opts)
+}
+
+// list fetches the operating systems from the API
+func (os *OperatingSystemServiceOp) list(opts *ListOptions) (operatingSystems []OperatingSystem, resp *Response, err error) {
 	apiPathQuery := opts.WithQuery(operatingSystemBasePath)
 
 	for {
@@ -102,3 +152,29 @@ func (os *OperatingSystemServiceOp) List(opts *ListOptions) (operatingSystems []
 		return
 	}
 }
+
+func (os *OperatingSystemServiceOp) find(field, value string, match func(OperatingSystem) bool) (*OperatingSystem, *Response, error) {
+	operatingSystems, resp, err := os.List(nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	for _, o := range operatingSystems {
+		if match(o) {
+			return &o, resp, nil
+		}
+	}
+	return nil, resp, fmt.Errorf("%w: %s %q", ErrOperatingSystemNotFound, field, value)
+}
+
+// Get returns the operating system with the given ID. The operating systems
+// are listed through List, so the catalog cache applies when it is enabled.
+func (os *OperatingSystemServiceOp) Get(osID string) (*OperatingSystem, *Response, error) {
+	return os.find("id", osID, func(o OperatingSystem) bool { return o.ID == osID })
+}
+
+// GetBySlug returns the operating system with the given slug, such as
+// "ubuntu_22_04_x64_lts". The operating systems are listed through List, so
+// the catalog cache applies when it is enabled.
+func (os *OperatingSystemServiceOp) GetBySlug(slug string) (*OperatingSystem, *Response, error) {
+	return os.find("slug", slug, func(o OperatingSystem) bool { return o.Slug == slug })
+}
@@ -0,0 +1,139 @@
+package latitude
+
+import "errors"
+
+// Plan features as listed in PlanFeatures
+const (
+	planFeatureSSH      = "ssh"
+	planFeatureRaid     = "raid"
+	planFeatureUserData = "user_data"
+)
+
+// osRequest holds the deploy options shared by create and reinstall requests
+type osRequest struct {
+	sshKeys  []string
+	userData string
+	raid     string
+}
+
+// validateOS checks the deploy options against the features of the OS and,
+// when plan is set, against the features and OS list of the plan. A plan
+// without features isn't checked for them.
+func validateOS(req osRequest, os OperatingSystem, plan *Plan) error {
+	verr := &ValidationError{}
+
+	if len(req.sshKeys) > 0 && !os.SshKeys {
+		verr.add("ssh_keys", "operating system %s does not support SSH keys", os.Slug)
+	}
+	if req.userData != "" && !os.UserData {
+		verr.add("user_data", "operating system %s does not support user data", os.Slug)
+	}
+	if req.raid != "" && req.raid != string(RaidNone) && !os.Raid {
+		verr.add("raid", "operating system %s does not support RAID", os.Slug)
+	}
+
+	if plan != nil && !os.ProvisionableOnPlan(plan.Slug) && !os.ProvisionableOnPlan(plan.Name) {
+		verr.add("operating_system", "operating system %s is not available on plan %s", os.Slug, plan.Slug)
+	}
+
+	// a plan that doesn't list its features supports any of them, like an OS
+	// that doesn't list its plans
+	if plan != nil && len(plan.Features) > 0 {
+		if len(req.sshKeys) > 0 && !containsFold(plan.Features, planFeatureSSH) {
+			verr.add("ssh_keys", "plan %s does not support SSH keys", plan.Slug)
+		}
+		if req.userData != "" && !containsFold(plan.Features, planFeatureUserData) {
+			verr.add("user_data", "plan %s does not support user data", plan.Slug)
+		}
+		if req.raid != "" && req.raid != string(RaidNone) && !containsFold(plan.Features, planFeatureRaid) {
+			verr.add("raid", "plan %s does not support RAID", plan.Slug)
+		}
+	}
+
+	return verr.errOrNil()
+}
+
+// ValidateOS checks the request against the features of the selected OS and
+// the features and OS list of the plan. plan may be nil to skip the plan
+// checks. Every violation is reported in a *ValidationError.
+func (a ServerCreateAttributes) ValidateOS(os OperatingSystem, plan *Plan) error {
+	return validateOS(osRequest{sshKeys: a.SSHKeys, userData: a.UserData, raid: a.Raid}, os, plan)
+}
+
+// ValidateOS checks the request against the features of the selected OS and
+// the features and OS list of the plan of the server. plan may be nil to skip
+// the plan checks. Every violation is reported in a *ValidationError.
+func (a ServerReinstallAttributes) ValidateOS(os OperatingSystem, plan *Plan) error {
+	return validateOS(osRequest{sshKeys: a.SSHKeys, userData: a.UserData, raid: a.Raid}, os, plan)
+}
+
+// lookupOS returns the OS with the given slug, reporting an unknown slug as
+// a violation
+func (c *Client) lookupOS(slug string) (*OperatingSystem, error) {
+	os, _, err := c.OperatingSystems.GetBySlug(slug)
+	if errors.Is(err, ErrOperatingSystemNotFound) {
+		verr := &ValidationError{}
+		verr.add("operating_system", "unknown operating system %q", slug)
+		return nil, verr
+	}
+	return os, err
+}
+
+// ValidateServerCreate looks up the OS and plan of the request and checks
+// that they support the requested deploy options. Requests without an OS,
+// such as iPXE deploys, are not checked.
+func (c *Client) ValidateServerCreate(req *ServerCreateRequest) error {
+	attrs := req.Data.Attributes
+	if attrs.OperatingSystem == "" {
+		return nil
+	}
+	os, err := c.lookupOS(attrs.OperatingSystem)
+	if err != nil {
+		return err
+	}
+
+	var plan *Plan
+	if attrs.Plan != "" {
+		plans, _, err := c.Plans.List(nil)
+		if err != nil {
+			return err
+		}
+		p, ok := findPlan(plans, attrs.Plan)
+		if !ok {
+			verr := &ValidationError{}
+			verr.add("plan", "unknown plan %q", attrs.Plan)
+			return verr
+		}
+		plan = &p
+	}
+	return attrs.ValidateOS(*os, plan)
+}
+
+// ValidateServerReinstall looks up the OS of the request and the plan of the
+// server and checks that they support the requested deploy options
+func (c *Client) ValidateServerReinstall(serverID string, req *ServerReinstallRequest) error {
+	attrs := req.Data.Attributes
+	if attrs.OperatingSystem == "" {
+		return nil
+	}
+	os, err := c.lookupOS(attrs.OperatingSystem)
+	if err != nil {
+		return err
+	}
+
+	server, _, err := c.Servers.Get(serverID, nil)
+	if err != nil {
+		return err
+	}
+	var plan *Plan
+	if server.Plan.Slug != "" {
+		plans, _, err := c.Plans.List(nil)
+		if err != nil {
+			return err
+		}
+		if p, ok := findPlan(plans, server.Plan.Slug); ok {
+			plan = &p
+		}
+	}
+	return attrs.ValidateOS(*os, plan)
+}
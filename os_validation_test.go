@@ -0,0 +1,104 @@
+package latitude
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServerCreateValidateOS(t *testing.T) {
+	os := OperatingSystem{Slug: "windows_2022_std", UserData: true, ProvisionableOn: []string{"c2.small.x86"}}
+	plan := &Plan{Slug: "c3-small-x86", Name: "c3.small.x86", Features: PlanFeatures{"ssh", "user_data"}}
+	attrs := ServerCreateAttributes{
+		OperatingSystem: os.Slug,
+		SSHKeys:         []string{"ssh_1"},
+		UserData:        "ud_1",
+		Raid:            string(Raid1),
+	}
+
+	err := attrs.ValidateOS(os, plan)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	expected := []Violation{
+		{Field: "ssh_keys", Message: "operating system windows_2022_std does not support SSH keys"},
+		{Field: "raid", Message: "operating system windows_2022_std does not support RAID"},
+		{Field: "operating_system", Message: "operating system windows_2022_std is not available on plan c3-small-x86"},
+		{Field: "raid", Message: "plan c3-small-x86 does not support RAID"},
+	}
+	assertEqual(t, len(verr.Violations), len(expected), "Violations")
+	for i, v := range expected {
+		assertEqual(t, verr.Violations[i], v, "Violation")
+	}
+
+	plan.Slug, plan.Name = "c2-small-x86", "c2.small.x86"
+	attrs = ServerCreateAttributes{OperatingSystem: os.Slug, UserData: "ud_1"}
+	if err := attrs.ValidateOS(os, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// the plan doesn't list its features, only the OS is checked
+	plan.Features = nil
+	attrs = ServerCreateAttributes{OperatingSystem: os.Slug, SSHKeys: []string{"ssh_1"}, UserData: "ud_1"}
+	err = attrs.ValidateOS(os, plan)
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	assertEqual(t, len(verr.Violations), 1, "Violations without plan features")
+	assertEqual(t, verr.Violations[0].Message, "operating system windows_2022_std does not support SSH keys", "Violation")
+
+	if err := (ServerReinstallAttributes{SSHKeys: []string{"ssh_1"}}).ValidateOS(os, nil); err == nil {
+		t.Fatal("Expected a violation for SSH keys on reinstall")
+	}
+}
+
+func TestOperatingSystemGetBySlug(t *testing.T) {
+	c := setupFixture(t, "TestAccOperatingSystemBasic")
+	if err := c.EnableCatalogCache(CatalogCacheOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	os, _, err := c.OperatingSystems.GetBySlug("rhel8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, os.UserData, false, "Operating System UserData")
+	assertEqual(t, os.ProvisionableOnPlan("c2.small.x86"), true, "Operating System provisionable")
+
+	// served from the catalog cache, the fixture only holds a single list interaction
+	byID, _, err := c.OperatingSystems.Get("os_KgXQvNe3azpbP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, byID.Slug, "centos_7_4_x64", "Operating System Slug")
+
+	if _, _, err := c.OperatingSystems.GetBySlug("templeos"); !errors.Is(err, ErrOperatingSystemNotFound) {
+		t.Fatalf("Expected ErrOperatingSystemNotFound, got %v", err)
+	}
+	err = c.ValidateServerCreate(&ServerCreateRequest{Data: ServerCreateData{Attributes: ServerCreateAttributes{OperatingSystem: "templeos"}}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Violations[0].Field != "operating_system" {
+		t.Fatalf("Expected an operating_system violation, got %v", err)
+	}
+}
+
+func TestServerCreateValidateOSFixtures(t *testing.T) {
+	os, _, err := setupFixture(t, "TestAccOperatingSystemBasic").OperatingSystems.GetBySlug("ubuntu_22_04_x64_lts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, _, err := setupFixture(t, "TestAccPlanBasic").Plans.Get("plan_2X6KG5mA5yPBM", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, plan.Slug, "c2-small-x86", "Plan Slug")
+
+	// provisionable_on lists plan names, the plan is matched by slug
+	if !os.ProvisionableOnPlan(plan.Slug) {
+		t.Fatalf("Expected %s to be provisionable on %s", os.Slug, plan.Slug)
+	}
+	attrs := ServerCreateAttributes{OperatingSystem: os.Slug, Plan: plan.Slug}
+	if err := attrs.ValidateOS(*os, plan); err != nil {
+		t.Fatal(err)
+	}
+}
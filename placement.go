@@ -0,0 +1,190 @@
+package latitude
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// StockLevel is how much capacity of a plan a site has
+type StockLevel string
+
+const (
+	StockLevelHigh        StockLevel = "high"
+	StockLevelMedium      StockLevel = "medium"
+	StockLevelLow         StockLevel = "low"
+	StockLevelUnavailable StockLevel = "unavailable"
+)
+
+// rank orders stock levels from most to least capacity, unknown levels last
+func (l StockLevel) rank() int {
+	switch l {
+	case StockLevelHigh:
+		return 0
+	case StockLevelMedium:
+		return 1
+	case StockLevelLow:
+		return 2
+	case StockLevelUnavailable:
+		return 4
+	}
+	return 3
+}
+
+// PlacementRequest describes where a server may be placed
+type PlacementRequest struct {
+	// Plan is the slug of the plan to place. When empty every plan accepted
+	// by Filter is considered.
+	Plan string
+
+	// Filter, if set, limits the plans considered, for example to spec
+	// constraints such as a minimum number of cores
+	Filter func(Plan) bool
+
+	// Sites and Countries restrict the candidates to the given site slugs
+	// and region names. Both empty means anywhere.
+	Sites     []string
+	Countries []string
+
+	// Billing and Currency pick the price candidates are ranked by,
+	// defaulting to hourly USD
+	Billing  BillingType
+	Currency PricingCurrency
+
+	// IncludeOutOfStock keeps sites without stock in the results, ranked last
+	IncludeOutOfStock bool
+}
+
+// PlacementCandidate is a site a plan can be deployed to
+type PlacementCandidate struct {
+	Plan       string
+	Site       string
+	Region     string
+	InStock    bool
+	StockLevel StockLevel
+	// Price is zero when the region has no price for the requested currency
+	// and billing
+	Price   float64
+	Pricing Pricing
+}
+
+// RankPlacements returns the sites the plans can be placed in, best first:
+// sites in stock before those without, higher stock levels first, then the
+// cheapest for the requested billing period, with unpriced sites last
+func RankPlacements(plans []Plan, req PlacementRequest) []PlacementCandidate {
+	var candidates []PlacementCandidate
+	for _, p := range plans {
+		if req.Plan != "" && p.Slug != req.Plan {
+			continue
+		}
+		if req.Filter != nil && !req.Filter(p) {
+			continue
+		}
+
+		levels := map[string]StockLevel{}
+		for _, a := range p.Availability {
+			for _, site := range a.Sites {
+				levels[strings.ToUpper(site.Name)] = StockLevel(site.StockLevel)
+			}
+		}
+
+		for _, region := range p.Regions {
+			if len(req.Countries) > 0 && !containsFold(req.Countries, region.Name) {
+				continue
+			}
+			for _, site := range region.Locations.Available {
+				if len(req.Sites) > 0 && !containsFold(req.Sites, site) {
+					continue
+				}
+				inStock := containsFold(region.Locations.InStock, site)
+				if !inStock && !req.IncludeOutOfStock {
+					continue
+				}
+				level, ok := levels[strings.ToUpper(site)]
+				if !ok && !inStock {
+					level = StockLevelUnavailable
+				}
+				candidates = append(candidates, PlacementCandidate{
+					Plan:       p.Slug,
+					Site:       site,
+					Region:     region.Name,
+					InStock:    inStock,
+					StockLevel: level,
+					Price:      region.PlanPricing.Price(req.Currency, req.Billing),
+					Pricing:    region.PlanPricing,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.InStock != b.InStock {
+			return a.InStock
+		}
+		if a.StockLevel.rank() != b.StockLevel.rank() {
+			return a.StockLevel.rank() < b.StockLevel.rank()
+		}
+		if (a.Price > 0) != (b.Price > 0) {
+			return a.Price > 0
+		}
+		if a.Price != b.Price {
+			return a.Price < b.Price
+		}
+		return a.Site < b.Site
+	})
+	return candidates
+}
+
+// Placements lists the plans and ranks the sites they can be placed in
+func (s *PlanServiceOp) Placements(req PlacementRequest) ([]PlacementCandidate, *Response, error) {
+	opts := &ListOptions{}
+	if req.Plan != "" {
+		opts = opts.Filter("slug", req.Plan)
+	}
+	plans, resp, err := s.List(opts)
+	if err != nil {
+		return nil, resp, err
+	}
+	return RankPlacements(plans, req), resp, nil
+}
+
+// CreateWithPlacement creates the server in the first candidate site that has
+// stock, falling back to the next candidate when the API reports the plan is
+// out of stock. The plan and site of createRequest are overwritten with those
+// of the candidate that is tried.
+func (s *ServerServiceOp) CreateWithPlacement(createRequest *ServerCreateRequest, candidates []PlacementCandidate) (*Server, *Response, error) {
+	if len(candidates) == 0 {
+		return nil, nil, errors.New("no placement candidates to create the server in")
+	}
+
+	var (
+		server *Server
+		resp   *Response
+		err    error
+	)
+	for _, c := range candidates {
+		createRequest.Data.Attributes.Plan = c.Plan
+		createRequest.Data.Attributes.Site = c.Site
+		server, resp, err = s.Create(createRequest)
+		if !isOutOfStock(err) {
+			return server, resp, err
+		}
+	}
+	return server, resp, err
+}
+
+// isOutOfStock reports whether err is an API error about missing stock
+func isOutOfStock(err error) bool {
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) {
+		return false
+	}
+	for _, e := range errResp.Errors {
+		text := strings.ToLower(e.Code + " " + e.Title + " " + e.Detail)
+		if strings.Contains(text, "stock") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package latitude
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testPlacementPlans() []Plan {
+	return []Plan{
+		{
+			Slug: "c2-small-x86",
+			Regions: PlanRegions{
+				{
+					Name:        "Brazil",
+					Locations:   PlanLocation{Available: []string{"SAO", "SAO2"}, InStock: []string{"SAO", "SAO2"}},
+					PlanPricing: Pricing{USD: PricingUSD{Hour: 0.22, Month: 153}},
+				},
+				{
+					Name:        "United States",
+					Locations:   PlanLocation{Available: []string{"NYC", "DAL"}, InStock: []string{"DAL"}},
+					PlanPricing: Pricing{USD: PricingUSD{Hour: 0.21, Month: 146}},
+				},
+			},
+			Availability: []PlanAvailability{
+				{Sites: []Site{{Name: "SAO", InStock: true, StockLevel: "low"}, {Name: "SAO2", InStock: true, StockLevel: "high"}}},
+			},
+		},
+		{Slug: "m4-metal-large", Regions: PlanRegions{{Name: "Brazil", Locations: PlanLocation{Available: []string{"SAO"}, InStock: []string{"SAO"}}}}},
+	}
+}
+
+func TestRankPlacements(t *testing.T) {
+	cs := RankPlacements(testPlacementPlans(), PlacementRequest{Plan: "c2-small-x86", Billing: BillingMonthly})
+	assertEqual(t, len(cs), 3, "In stock candidates")
+	assertEqual(t, cs[0].Site, "SAO2", "Highest stock first")
+	assertEqual(t, cs[1].Site, "SAO", "Then lower stock")
+	assertEqual(t, cs[2].Site, "DAL", "Unknown stock level last")
+	assertEqual(t, cs[2].Price, 146.0, "Monthly price")
+
+	cs = RankPlacements(testPlacementPlans(), PlacementRequest{Plan: "c2-small-x86", Countries: []string{"united states"}, IncludeOutOfStock: true})
+	assertEqual(t, len(cs), 2, "Country candidates")
+	assertEqual(t, cs[1].Site, "NYC", "Out of stock last")
+	assertEqual(t, cs[1].StockLevel, StockLevelUnavailable, "Out of stock level")
+
+	cs = RankPlacements(testPlacementPlans(), PlacementRequest{Sites: []string{"sao"}, Filter: func(p Plan) bool { return p.Slug == "m4-metal-large" }})
+	assertEqual(t, len(cs), 1, "Filtered candidates")
+	assertEqual(t, cs[0].Plan, "m4-metal-large", "Filtered plan")
+
+	// a plan without pricing in DAL ranks after the priced one with the same
+	// stock instead of looking free
+	unpriced := Plan{Slug: "m4-metal-large", Regions: PlanRegions{{Name: "United States", Locations: PlanLocation{Available: []string{"DAL"}, InStock: []string{"DAL"}}}}}
+	cs = RankPlacements([]Plan{unpriced, testPlacementPlans()[0]}, PlacementRequest{Sites: []string{"DAL"}, Billing: BillingMonthly})
+	assertEqual(t, len(cs), 2, "DAL candidates")
+	assertEqual(t, cs[0].Plan, "c2-small-x86", "Priced plan first")
+	assertEqual(t, cs[1].Plan, "m4-metal-large", "Unpriced plan last")
+}
+
+func TestServerCreateWithPlacement(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	var sites []string
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"status":"on"}}}`)
+			return
+		}
+		var req ServerCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		sites = append(sites, req.Data.Attributes.Site)
+		if req.Data.Attributes.Site == "SAO2" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"errors":[{"code":"SITE_OUT_OF_STOCK","status":"422","title":"Plan is out of stock"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"site":%q}}}`, req.Data.Attributes.Site)
+	})
+
+	cs := RankPlacements(testPlacementPlans(), PlacementRequest{Plan: "c2-small-x86"})
+	s, _, err := c.Servers.CreateWithPlacement(&ServerCreateRequest{Data: ServerCreateData{Type: testServerType}}, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(sites), 2, "Create attempts")
+	assertEqual(t, s.Site, "SAO", "Fallback site")
+}
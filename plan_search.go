@@ -0,0 +1,156 @@
+package latitude
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// PlanQuery selects plans by hardware specs, price and stock. Zero valued
+// fields don't constrain the results.
+type PlanQuery struct {
+	MinCores        int
+	MinMemoryGB     float64
+	MinNVMeGB       float64
+	MinDiskGB       float64
+	MinNICSpeedGbps float64
+
+	// GPU requires the plan to have a GPU, GPUModel additionally requires
+	// its model to contain the given text, such as "H100"
+	GPU      bool
+	GPUModel string
+
+	// MaxMonthlyPrice is the highest monthly price in Currency, which
+	// defaults to USD
+	MaxMonthlyPrice float64
+	Currency        PricingCurrency
+
+	// InStockIn requires the plan to be in stock in at least one of the given
+	// sites or regions, such as "SAO" or "Brazil". Prices are only taken from
+	// matching regions.
+	InStockIn []string
+}
+
+// PlanMatch is a plan selected by a PlanQuery, along with its cheapest
+// eligible region and monthly price. Priced is false when no eligible region
+// has a price in the query currency, MonthlyPrice is then zero.
+type PlanMatch struct {
+	Plan         Plan
+	Region       string
+	MonthlyPrice float64
+	Priced       bool
+}
+
+// Match reports whether the plan satisfies every constraint of the query
+func (q PlanQuery) Match(p Plan) bool {
+	_, ok := q.match(p)
+	return ok
+}
+
+func (q PlanQuery) match(p Plan) (PlanMatch, bool) {
+	specs := p.Specs
+	if specs.TotalCores() < q.MinCores {
+		return PlanMatch{}, false
+	}
+	if q.MinMemoryGB > 0 {
+		if gb, err := specs.MemoryGB(); err != nil || gb < q.MinMemoryGB {
+			return PlanMatch{}, false
+		}
+	}
+	if q.MinNVMeGB > 0 {
+		if gb, err := specs.DriveCapacityGB("NVME"); err != nil || gb < q.MinNVMeGB {
+			return PlanMatch{}, false
+		}
+	}
+	if q.MinDiskGB > 0 {
+		if gb, err := specs.DriveCapacityGB(""); err != nil || gb < q.MinDiskGB {
+			return PlanMatch{}, false
+		}
+	}
+	if q.MinNICSpeedGbps > 0 {
+		if gbps, err := specs.NICSpeedGbps(); err != nil || gbps < q.MinNICSpeedGbps {
+			return PlanMatch{}, false
+		}
+	}
+	if (q.GPU || q.GPUModel != "") && !specs.HasGPU() {
+		return PlanMatch{}, false
+	}
+	if q.GPUModel != "" && !strings.Contains(strings.ToLower(specs.GPU.Type), strings.ToLower(q.GPUModel)) {
+		return PlanMatch{}, false
+	}
+
+	match := PlanMatch{Plan: p, MonthlyPrice: math.Inf(1)}
+	eligible := ""
+	for _, region := range p.Regions {
+		if len(q.InStockIn) > 0 && !regionInStock(region, q.InStockIn) {
+			continue
+		}
+		if eligible == "" {
+			eligible = region.Name
+		}
+		// a region without a price can't be compared, so it's never the
+		// cheapest one
+		price := region.PlanPricing.Price(q.Currency, BillingMonthly)
+		if price > 0 && price < match.MonthlyPrice {
+			match.MonthlyPrice = price
+			match.Region = region.Name
+			match.Priced = true
+		}
+	}
+	if eligible == "" && len(q.InStockIn) > 0 {
+		// no region satisfies the stock constraint
+		return PlanMatch{}, false
+	}
+	if !match.Priced {
+		if q.MaxMonthlyPrice > 0 {
+			return PlanMatch{}, false
+		}
+		match.MonthlyPrice = 0
+		match.Region = eligible
+	}
+	if q.MaxMonthlyPrice > 0 && match.MonthlyPrice > q.MaxMonthlyPrice {
+		return PlanMatch{}, false
+	}
+	return match, true
+}
+
+// regionInStock reports whether the region has stock in one of the sites, or
+// any stock at all when the region name itself is listed
+func regionInStock(region PlanRegion, where []string) bool {
+	if containsFold(where, region.Name) {
+		return len(region.Locations.InStock) > 0
+	}
+	for _, site := range region.Locations.InStock {
+		if containsFold(where, site) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchPlans returns the plans matching the query, cheapest first and the
+// plans without a price last
+func SearchPlans(plans []Plan, q PlanQuery) []PlanMatch {
+	var matches []PlanMatch
+	for _, p := range plans {
+		if m, ok := q.match(p); ok {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Priced != matches[j].Priced {
+			return matches[i].Priced
+		}
+		return matches[i].MonthlyPrice < matches[j].MonthlyPrice
+	})
+	return matches
+}
+
+// Search lists the plans and returns those matching the query, cheapest first
+func (s *PlanServiceOp) Search(q PlanQuery) ([]PlanMatch, *Response, error) {
+	plans, resp, err := s.List(nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	return SearchPlans(plans, q), resp, nil
+}
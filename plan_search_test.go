@@ -0,0 +1,99 @@
+package latitude
+
+import (
+	"testing"
+)
+
+func TestPlanSpecsParsing(t *testing.T) {
+	specs := PlanSpecs{
+		CPU:    PlanCPU{Cores: 24, Count: 2},
+		Memory: PlanMemory{Total: "256"},
+		Drives: []PlanDrive{{Count: 2, Size: "480GB", Type: "NVME"}, {Count: 1, Size: "2 x 960 GB", Type: "SSD"}, {Count: 2, Size: "3.8TB", Type: "NVME"}},
+		NICs:   []PlanNIC{{Count: 1, Type: "2 x 10Gbps"}, {Count: 1, Type: "1 Gbps"}},
+	}
+
+	assertEqual(t, specs.TotalCores(), 48, "Total cores")
+	mem, err := specs.MemoryGB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, mem, 256.0, "Memory GB")
+	nvme, err := specs.DriveCapacityGB("nvme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, nvme, 8560.0, "NVMe capacity")
+	all, err := specs.DriveCapacityGB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, all, 10480.0, "Total capacity")
+	speed, err := specs.NICSpeedGbps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, speed, 10.0, "NIC speed")
+}
+
+func TestPlanSearchFixture(t *testing.T) {
+	c := setupFixture(t, "TestAccPlanBasic")
+
+	matches, _, err := c.Plans.Search(PlanQuery{MinMemoryGB: 128, InStockIn: []string{"SAO"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("expected plans with at least 128GB of memory in stock in SAO")
+	}
+	for i, m := range matches {
+		gb, _ := m.Plan.Specs.MemoryGB()
+		if gb < 128 {
+			t.Fatalf("plan %s has %v GB of memory", m.Plan.Slug, gb)
+		}
+		if !containsFold(m.Plan.InStock, "SAO") {
+			t.Fatalf("plan %s is not in stock in SAO", m.Plan.Slug)
+		}
+		if i > 0 && matches[i-1].Priced && m.Priced && m.MonthlyPrice < matches[i-1].MonthlyPrice {
+			t.Fatal("matches should be sorted by monthly price")
+		}
+		if i > 0 && !matches[i-1].Priced && m.Priced {
+			t.Fatal("plans without a price should come last")
+		}
+	}
+
+	c = setupFixture(t, "TestAccPlanBasic")
+	gpus, _, err := c.Plans.Search(PlanQuery{GPUModel: "h100", MaxMonthlyPrice: 1e9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range gpus {
+		if !m.Plan.Specs.HasGPU() {
+			t.Fatalf("plan %s has no GPU", m.Plan.Slug)
+		}
+	}
+	if len(gpus) == 0 {
+		t.Fatal("expected H100 plans")
+	}
+}
+
+func TestPlanSearchUnpriced(t *testing.T) {
+	priced := func(month float64) Pricing { return Pricing{USD: PricingUSD{Month: month}} }
+	plans := []Plan{
+		{Slug: "unpriced", Regions: PlanRegions{{Name: "Brazil"}}},
+		{Slug: "mixed", Regions: PlanRegions{{Name: "Brazil"}, {Name: "Chile", PlanPricing: priced(300)}}},
+		{Slug: "cheap", Regions: PlanRegions{{Name: "Brazil", PlanPricing: priced(100)}}},
+	}
+
+	matches := SearchPlans(plans, PlanQuery{})
+	assertEqual(t, len(matches), 3, "Matches without a price constraint")
+	assertEqual(t, matches[0].Plan.Slug, "cheap", "Cheapest plan")
+	assertEqual(t, matches[1].Plan.Slug, "mixed", "Second plan")
+	assertEqual(t, matches[1].Region, "Chile", "Priced region of a mixed plan")
+	assertEqual(t, matches[2].Plan.Slug, "unpriced", "Unpriced plan last")
+	assertEqual(t, matches[2].Priced, false, "Unpriced plan")
+	assertEqual(t, matches[2].Region, "Brazil", "Region of an unpriced plan")
+
+	matches = SearchPlans(plans, PlanQuery{MaxMonthlyPrice: 200})
+	assertEqual(t, len(matches), 1, "Matches under the maximum price")
+	assertEqual(t, matches[0].Plan.Slug, "cheap", "Plan under the maximum price")
+}
@@ -12,6 +12,8 @@ const planBasePath = "/plans"
 type PlanService interface {
 	List(listOpt *ListOptions) ([]Plan, *Response, error)
 	Get(string, *GetOptions) (*Plan, *Response, error)
+	Placements(req PlacementRequest) ([]PlacementCandidate, *Response, error)
+	Search(q PlanQuery) ([]PlanMatch, *Response, error)
 }
 
 // Plan represents a Latitude plan
@@ -47,6 +49,7 @@ type PlanSpecs struct {
 	Memory PlanMemory  `json:"memory"`
 	Drives []PlanDrive `json:"drives"`
 	NICs   []PlanNIC   `json:"nics"`
+	GPU    PlanGPU     `json:"gpu"`
 }
 
 type PlanCPU struct {
@@ -96,6 +99,11 @@ type PlanNIC struct {
 	Type  string `json:"type"`
 }
 
+type PlanGPU struct {
+	Count int    `json:"count"`
+	Type  string `json:"type"`
+}
+
 type PlanAvailability struct {
 	Region  PlanRegion `json:"region"`
 	Sites   []Site     `json:"sites"`
@@ -140,6 +148,39 @@ type PricingBRL struct {
 	Year  float64 `json:"year"`
 }
 
+// BillingType is how often a server is billed
+type BillingType string
+
+const (
+	BillingHourly  BillingType = "hourly"
+	BillingMonthly BillingType = "monthly"
+	BillingYearly  BillingType = "yearly"
+)
+
+// PricingCurrency is a currency plans are priced in
+type PricingCurrency string
+
+const (
+	CurrencyUSD PricingCurrency = "USD"
+	CurrencyBRL PricingCurrency = "BRL"
+)
+
+// Price returns the price for a billing period in the given currency,
+// defaulting to hourly USD pricing
+func (p Pricing) Price(currency PricingCurrency, billing BillingType) float64 {
+	hour, month, year := p.USD.Hour, p.USD.Month, p.USD.Year
+	if currency == CurrencyBRL {
+		hour, month, year = p.BRL.Hour, p.BRL.Month, p.BRL.Year
+	}
+	switch billing {
+	case BillingMonthly:
+		return month
+	case BillingYearly:
+		return year
+	}
+	return hour
+}
+
 type Plan struct {
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
@@ -148,11 +189,16 @@ type Plan struct {
 	Features PlanFeatures `json:"features"`
 	Specs    PlanSpecs    `json:"specs"`
 	InStock  []string     `json:"in_stock"`
+	Regions  PlanRegions  `json:"regions"`
+
+	// Availability is the per site stock of the plan, when returned by the API
+	Availability []PlanAvailability `json:"available_in"`
 }
 
 // PlanServiceOp implements PlanService
 type PlanServiceOp struct {
-	client requestDoer
+	client  requestDoer
+	catalog *catalogCache
 }
 
 func (pd *PlanData) allStock() []string {
@@ -173,6 +219,8 @@ func NewFlatPlan(pd PlanData) Plan {
 		pd.Attributes.Features,
 		pd.Attributes.Specs,
 		pd.allStock(),
+		pd.Attributes.Regions,
+		pd.Attributes.Availablility,
 	}
 }
 
@@ -184,8 +232,17 @@ func NewFlatPlanList(pd []PlanData) []Plan {
 	return res
 }
 
-// List returns a list of plans
+// List returns a list of plans. Unfiltered lists are served from the catalog
+// cache when it is enabled, see Client.EnableCatalogCache.
 func (s *PlanServiceOp) List(opts *ListOptions) ([]Plan, *Response, error) {
+	if opts == nil && s.catalog.isEnabled() {
+		return catalogList(s.catalog, CatalogPlans, func() ([]Plan, *Response, error) { return s.list(nil) })
+	}
+	return s.list(opts)
+}
+
+// list fetches the plans from the API
+func (s *PlanServiceOp) list(opts *ListOptions) ([]Plan, *Response, error) {
 	apiPathQuery := opts.WithQuery(planBasePath)
 
 	plans := []Plan{}
@@ -0,0 +1,938 @@
+package latitude
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FleetSpec is a desired-state document describing the resources a team
+// wants to exist. It is usually loaded from YAML with LoadFleetSpec.
+//
+// Projects and tags are never deleted by a reconcile. Every other resource
+// inside a project listed in the spec is owned by the spec: anything that
+// exists in the project but isn't listed is planned for deletion.
+type FleetSpec struct {
+	Tags     []FleetTag     `yaml:"tags"`
+	Projects []FleetProject `yaml:"projects"`
+}
+
+type FleetTag struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Color       string `yaml:"color"`
+}
+
+type FleetProject struct {
+	Name             string                `yaml:"name"`
+	Description      string                `yaml:"description"`
+	Environment      string                `yaml:"environment"`
+	ProvisioningType string                `yaml:"provisioning_type"`
+	SSHKeys          []FleetSSHKey         `yaml:"ssh_keys"`
+	Servers          []FleetServer         `yaml:"servers"`
+	VirtualNetworks  []FleetVirtualNetwork `yaml:"virtual_networks"`
+	Firewalls        []FleetFirewall       `yaml:"firewalls"`
+}
+
+type FleetSSHKey struct {
+	Name      string `yaml:"name"`
+	PublicKey string `yaml:"public_key"`
+}
+
+// FleetServer is a server identified by its hostname. SSHKeys and Tags refer
+// to ssh keys and tags by name.
+type FleetServer struct {
+	Hostname        string   `yaml:"hostname"`
+	Plan            string   `yaml:"plan"`
+	Site            string   `yaml:"site"`
+	OperatingSystem string   `yaml:"operating_system"`
+	Billing         string   `yaml:"billing"`
+	SSHKeys         []string `yaml:"ssh_keys"`
+	Tags            []string `yaml:"tags"`
+}
+
+// FleetVirtualNetwork is a VLAN identified by its description. Servers lists
+// the hostnames assigned to it.
+type FleetVirtualNetwork struct {
+	Description string   `yaml:"description"`
+	Site        string   `yaml:"site"`
+	Servers     []string `yaml:"servers"`
+}
+
+// FleetFirewall is a firewall identified by its name. Servers lists the
+// hostnames it is assigned to.
+type FleetFirewall struct {
+	Name    string         `yaml:"name"`
+	Rules   []FirewallRule `yaml:"rules"`
+	Servers []string       `yaml:"servers"`
+}
+
+// LoadFleetSpec decodes a YAML desired-state document
+func LoadFleetSpec(r io.Reader) (*FleetSpec, error) {
+	spec := new(FleetSpec)
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(spec); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return spec, spec.Validate()
+}
+
+// LoadFleetSpecFile decodes the YAML desired-state document at path
+func LoadFleetSpecFile(path string) (*FleetSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadFleetSpec(f)
+}
+
+// Validate checks that every resource has its identifying field set, that
+// names are unique and that references point to resources in the spec
+func (s *FleetSpec) Validate() error {
+	verr := &ValidationError{}
+
+	tags := map[string]bool{}
+	for i, t := range s.Tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		if t.Name == "" {
+			verr.add(field+".name", "name is required")
+		} else if tags[t.Name] {
+			verr.add(field+".name", "tag %q is defined more than once", t.Name)
+		}
+		tags[t.Name] = true
+	}
+
+	projects := map[string]bool{}
+	for i, p := range s.Projects {
+		pfield := fmt.Sprintf("projects[%d]", i)
+		if p.Name == "" {
+			verr.add(pfield+".name", "name is required")
+		} else if projects[p.Name] {
+			verr.add(pfield+".name", "project %q is defined more than once", p.Name)
+		}
+		projects[p.Name] = true
+
+		keys := map[string]bool{}
+		for j, k := range p.SSHKeys {
+			field := fmt.Sprintf("%s.ssh_keys[%d]", pfield, j)
+			if k.Name == "" {
+				verr.add(field+".name", "name is required")
+			} else if keys[k.Name] {
+				verr.add(field+".name", "ssh key %q is defined more than once", k.Name)
+			}
+			keys[k.Name] = true
+		}
+
+		servers := map[string]bool{}
+		for j, sv := range p.Servers {
+			field := fmt.Sprintf("%s.servers[%d]", pfield, j)
+			if sv.Hostname == "" {
+				verr.add(field+".hostname", "hostname is required")
+			} else if servers[sv.Hostname] {
+				verr.add(field+".hostname", "server %q is defined more than once", sv.Hostname)
+			}
+			servers[sv.Hostname] = true
+			for _, k := range sv.SSHKeys {
+				if !keys[k] {
+					verr.add(field+".ssh_keys", "unknown ssh key %q", k)
+				}
+			}
+			for _, t := range sv.Tags {
+				if !tags[t] {
+					verr.add(field+".tags", "unknown tag %q", t)
+				}
+			}
+		}
+
+		vlans := map[string]bool{}
+		for j, vn := range p.VirtualNetworks {
+			field := fmt.Sprintf("%s.virtual_networks[%d]", pfield, j)
+			if vn.Description == "" {
+				verr.add(field+".description", "description is required")
+			} else if vlans[vn.Description] {
+				verr.add(field+".description", "virtual network %q is defined more than once", vn.Description)
+			}
+			vlans[vn.Description] = true
+			for _, hn := range vn.Servers {
+				if !servers[hn] {
+					verr.add(field+".servers", "unknown server %q", hn)
+				}
+			}
+		}
+
+		firewalls := map[string]bool{}
+		for j, fw := range p.Firewalls {
+			field := fmt.Sprintf("%s.firewalls[%d]", pfield, j)
+			if fw.Name == "" {
+				verr.add(field+".name", "name is required")
+			} else if firewalls[fw.Name] {
+				verr.add(field+".name", "firewall %q is defined more than once", fw.Name)
+			}
+			firewalls[fw.Name] = true
+			for _, hn := range fw.Servers {
+				if !servers[hn] {
+					verr.add(field+".servers", "unknown server %q", hn)
+				}
+			}
+		}
+	}
+
+	return verr.errOrNil()
+}
+
+// ReconcileActionType is what an action does to a resource
+type ReconcileActionType string
+
+const (
+	ReconcileCreate ReconcileActionType = "create"
+	ReconcileUpdate ReconcileActionType = "update"
+	ReconcileDelete ReconcileActionType = "delete"
+)
+
+// ReconcileResource is the kind of resource an action applies to
+type ReconcileResource string
+
+const (
+	ReconcileTag                ReconcileResource = "tag"
+	ReconcileProject            ReconcileResource = "project"
+	ReconcileSSHKey             ReconcileResource = "ssh_key"
+	ReconcileServer             ReconcileResource = "server"
+	ReconcileVirtualNetwork     ReconcileResource = "virtual_network"
+	ReconcileVlanAssignment     ReconcileResource = "vlan_assignment"
+	ReconcileFirewall           ReconcileResource = "firewall"
+	ReconcileFirewallAssignment ReconcileResource = "firewall_assignment"
+)
+
+// ReconcileAction is a single change of a plan. Key identifies the resource
+// in the spec, as "<resource>/<project>/<name>", and DependsOn lists the keys
+// of the resources that must exist before the action can run.
+type ReconcileAction struct {
+	Type      ReconcileActionType
+	Resource  ReconcileResource
+	Key       string
+	ID        string
+	Reason    string
+	DependsOn []string
+
+	// run applies the action and returns the id of the resource
+	run func(c *Client, refs map[string]string) (string, error)
+}
+
+func (a ReconcileAction) String() string {
+	sign := map[ReconcileActionType]string{ReconcileCreate: "+", ReconcileUpdate: "~", ReconcileDelete: "-"}[a.Type]
+	s := fmt.Sprintf("%s %s %s", sign, a.Type, a.Key)
+	if a.Reason != "" {
+		s += " (" + a.Reason + ")"
+	}
+	return s
+}
+
+// ReconcilePlan is the ordered list of actions that brings the current state
+// to the desired state. Creates and updates come first, in dependency order,
+// followed by deletes in reverse dependency order.
+type ReconcilePlan struct {
+	Actions []ReconcileAction
+
+	// refs maps the keys of existing resources to their ids
+	refs map[string]string
+}
+
+// Empty reports whether the current state already matches the spec
+func (p *ReconcilePlan) Empty() bool {
+	return len(p.Actions) == 0
+}
+
+// Count returns the number of actions of the given type
+func (p *ReconcilePlan) Count(t ReconcileActionType) int {
+	n := 0
+	for _, a := range p.Actions {
+		if a.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes a human readable version of the plan to w
+func (p *ReconcilePlan) Print(w io.Writer) error {
+	for _, a := range p.Actions {
+		if _, err := fmt.Fprintln(w, a.String()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n",
+		p.Count(ReconcileCreate), p.Count(ReconcileUpdate), p.Count(ReconcileDelete))
+	return err
+}
+
+// ReconcileApplyOptions are the guardrails of Reconciler.Apply
+type ReconcileApplyOptions struct {
+	// AllowDeletes must be set for a plan with delete actions to be applied
+	AllowDeletes bool
+
+	// MaxDeletes refuses plans with more deletes than this, zero means no limit
+	MaxDeletes int
+
+	// ContinueOnError keeps applying the actions that don't depend on a
+	// failed one instead of stopping at the first error
+	ContinueOnError bool
+}
+
+// ReconcileGuardrailError is returned when Apply refuses to run a plan
+type ReconcileGuardrailError struct {
+	Reason string
+}
+
+func (e *ReconcileGuardrailError) Error() string {
+	return "refusing to apply plan: " + e.Reason
+}
+
+// ReconcileResult is the outcome of an applied action
+type ReconcileResult struct {
+	Action  ReconcileAction
+	ID      string
+	Err     error
+	Skipped bool
+}
+
+// Reconciler computes and applies plans through the client services
+type Reconciler struct {
+	client *Client
+}
+
+// NewReconciler returns a Reconciler using the given client
+func NewReconciler(c *Client) *Reconciler {
+	return &Reconciler{client: c}
+}
+
+// projectState is the current state of the resources of a project
+type projectState struct {
+	project             Project
+	sshKeys             map[string]SSHKey
+	servers             map[string]Server
+	vlans               map[string]VirtualNetwork
+	vlanAssignments     map[string][]VlanAssignment
+	firewalls           map[string]Firewall
+	firewallAssignments map[string][]FirewallAssignment
+}
+
+func reconcileKey(resource ReconcileResource, parts ...string) string {
+	return string(resource) + "/" + strings.Join(parts, "/")
+}
+
+// serverDeleteKey is the key of the delete of a replaced server, distinct
+// from the key of its replacement
+func serverDeleteKey(project, hostname string) string {
+	return string(ReconcileServer) + "-delete/" + project + "/" + hostname
+}
+
+// Plan reads the current state through the client services and returns the
+// actions needed to reach spec
+func (r *Reconciler) Plan(spec *FleetSpec) (*ReconcilePlan, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	plan := &ReconcilePlan{refs: map[string]string{}}
+	var creates, deletes []ReconcileAction
+
+	tags, _, err := r.client.Tags.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	currentTags := map[string]Tag{}
+	for _, t := range tags {
+		currentTags[t.Name] = t
+		plan.refs[reconcileKey(ReconcileTag, t.Name)] = t.ID
+	}
+	for _, t := range spec.Tags {
+		t := t
+		key := reconcileKey(ReconcileTag, t.Name)
+		attrs := TagCreateAttributes{Name: t.Name, Description: t.Description, Color: t.Color}
+		cur, ok := currentTags[t.Name]
+		switch {
+		case !ok:
+			creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileTag, Key: key,
+				run: func(c *Client, refs map[string]string) (string, error) {
+					tag, _, err := c.Tags.Create(&TagCreateRequest{Data: TagCreateData{Type: "tags", Attributes: attrs}})
+					if err != nil {
+						return "", err
+					}
+					return tag.ID, nil
+				}})
+		case (t.Description != "" && t.Description != cur.Description) || (t.Color != "" && !strings.EqualFold(t.Color, cur.Color)):
+			creates = append(creates, ReconcileAction{Type: ReconcileUpdate, Resource: ReconcileTag, Key: key, ID: cur.ID, Reason: "description or color changed",
+				run: func(c *Client, refs map[string]string) (string, error) {
+					_, _, err := c.Tags.Update(cur.ID, &TagUpdateRequest{Data: TagUpdateData{ID: cur.ID, Type: "tags", Attributes: TagUpdateAttributes(attrs)}})
+					return cur.ID, err
+				}})
+		}
+	}
+
+	projects, _, err := r.client.Projects.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	currentProjects := map[string]Project{}
+	for _, p := range projects {
+		currentProjects[p.Name] = p
+	}
+
+	for _, p := range spec.Projects {
+		var state *projectState
+		if cur, ok := currentProjects[p.Name]; ok {
+			plan.refs[reconcileKey(ReconcileProject, p.Name)] = cur.ID
+			if state, err = r.readProject(cur, plan.refs); err != nil {
+				return nil, err
+			}
+		}
+		c, d := planProject(p, state)
+		creates = append(creates, c...)
+		deletes = append(deletes, d...)
+	}
+
+	// deletes run dependents first: assignments, then servers, firewalls and
+	// vlans, then ssh keys
+	order := map[ReconcileResource]int{
+		ReconcileVlanAssignment: 0, ReconcileFirewallAssignment: 0,
+		ReconcileServer: 1, ReconcileFirewall: 1, ReconcileVirtualNetwork: 1,
+		ReconcileSSHKey: 2,
+	}
+	sort.SliceStable(deletes, func(i, j int) bool {
+		if order[deletes[i].Resource] != order[deletes[j].Resource] {
+			return order[deletes[i].Resource] < order[deletes[j].Resource]
+		}
+		return deletes[i].Key < deletes[j].Key
+	})
+	plan.Actions = append(creates, deletes...)
+	return plan, nil
+}
+
+func (r *Reconciler) readProject(p Project, refs map[string]string) (*projectState, error) {
+	state := &projectState{
+		project:             p,
+		sshKeys:             map[string]SSHKey{},
+		servers:             map[string]Server{},
+		vlans:               map[string]VirtualNetwork{},
+		vlanAssignments:     map[string][]VlanAssignment{},
+		firewalls:           map[string]Firewall{},
+		firewallAssignments: map[string][]FirewallAssignment{},
+	}
+
+	keys, _, err := r.client.SSHKeys.List(p.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		state.sshKeys[k.Name] = k
+		refs[reconcileKey(ReconcileSSHKey, p.Name, k.Name)] = k.ID
+	}
+
+	servers, _, err := r.client.Servers.List(p.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	serverIDs := map[string]bool{}
+	for _, s := range servers {
+		state.servers[s.Hostname] = s
+		serverIDs[s.ID] = true
+		refs[reconcileKey(ReconcileServer, p.Name, s.Hostname)] = s.ID
+	}
+
+	vlans, _, err := r.client.VirtualNetworks.List(new(ListOptions).Filter("project", p.ID))
+	if err != nil {
+		return nil, err
+	}
+	vlanIDs := map[string]string{}
+	for _, vn := range vlans {
+		state.vlans[vn.Description] = vn
+		vlanIDs[vn.ID] = vn.Description
+		refs[reconcileKey(ReconcileVirtualNetwork, p.Name, vn.Description)] = vn.ID
+	}
+	if len(vlans) > 0 {
+		assignments, _, err := r.client.VlanAssignments.List(nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range assignments {
+			if desc, ok := vlanIDs[a.VirtualNetworkID]; ok {
+				state.vlanAssignments[desc] = append(state.vlanAssignments[desc], a)
+			}
+		}
+	}
+
+	firewalls, _, err := r.client.Firewalls.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, fw := range firewalls {
+		if fw.Project.ID != p.ID {
+			continue
+		}
+		state.firewalls[fw.Name] = fw
+		refs[reconcileKey(ReconcileFirewall, p.Name, fw.Name)] = fw.ID
+		assignments, _, err := r.client.Firewalls.ListAssignments(fw.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		state.firewallAssignments[fw.Name] = assignments
+	}
+
+	return state, nil
+}
+
+// planProject returns the create/update and delete actions of a project,
+// state is nil when the project doesn't exist yet
+func planProject(p FleetProject, state *projectState) (creates, deletes []ReconcileAction) {
+	projectKey := reconcileKey(ReconcileProject, p.Name)
+	projectRef := func(refs map[string]string) string { return refs[projectKey] }
+
+	if state == nil {
+		state = &projectState{}
+		attrs := ProjectCreateAttributes{Name: p.Name, Description: p.Description, Environment: p.Environment, ProvisioningType: p.ProvisioningType}
+		creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileProject, Key: projectKey,
+			run: func(c *Client, refs map[string]string) (string, error) {
+				project, _, err := c.Projects.Create(&ProjectCreateRequest{Data: ProjectCreateData{Type: "projects", Attributes: attrs}})
+				if err != nil {
+					return "", err
+				}
+				return project.ID, nil
+			}})
+	} else if (p.Description != "" && p.Description != state.project.Description) || (p.Environment != "" && p.Environment != state.project.Environment) {
+		id := state.project.ID
+		attrs := ProjectUpdateAttributes{Name: p.Name, Description: p.Description, Environment: p.Environment}
+		if attrs.Environment == "" {
+			attrs.Environment = state.project.Environment
+		}
+		creates = append(creates, ReconcileAction{Type: ReconcileUpdate, Resource: ReconcileProject, Key: projectKey, ID: id, Reason: "description or environment changed",
+			run: func(c *Client, refs map[string]string) (string, error) {
+				_, _, err := c.Projects.Update(id, &ProjectUpdateRequest{Data: ProjectUpdateData{ID: id, Type: "projects", Attributes: attrs}})
+				return id, err
+			}})
+	}
+
+	// ssh keys can't change their public key, so a changed key is replaced
+	wantKeys := map[string]bool{}
+	for _, k := range p.SSHKeys {
+		k := k
+		wantKeys[k.Name] = true
+		key := reconcileKey(ReconcileSSHKey, p.Name, k.Name)
+		create := ReconcileAction{Type: ReconcileCreate, Resource: ReconcileSSHKey, Key: key, DependsOn: []string{projectKey},
+			run: func(c *Client, refs map[string]string) (string, error) {
+				sshKey, _, err := c.SSHKeys.Create(projectRef(refs), &SSHKeyCreateRequest{Data: SSHKeyCreateData{Type: "ssh_keys", Attributes: SSHKeyCreateAttributes{Name: k.Name, PublicKey: k.PublicKey}}})
+				if err != nil {
+					return "", err
+				}
+				return sshKey.ID, nil
+			}}
+		cur, ok := state.sshKeys[k.Name]
+		if !ok {
+			creates = append(creates, create)
+			continue
+		}
+		if strings.TrimSpace(cur.PublicKey) != strings.TrimSpace(k.PublicKey) {
+			// the old key is deleted first so the name is free again
+			creates = append(creates, deleteSSHKeyAction(p.Name, cur, "public key changed"), create)
+		}
+	}
+	for name, cur := range state.sshKeys {
+		if !wantKeys[name] {
+			deletes = append(deletes, deleteSSHKeyAction(p.Name, cur, "not in spec"))
+		}
+	}
+
+	// a replaced server loses its assignments, they are deleted before the
+	// server and created again for the new one
+	replaced := map[string]bool{}
+	wantServers := map[string]bool{}
+	for _, sv := range p.Servers {
+		sv := sv
+		wantServers[sv.Hostname] = true
+		key := reconcileKey(ReconcileServer, p.Name, sv.Hostname)
+		deps := []string{projectKey}
+		for _, k := range sv.SSHKeys {
+			deps = append(deps, reconcileKey(ReconcileSSHKey, p.Name, k))
+		}
+		for _, t := range sv.Tags {
+			deps = append(deps, reconcileKey(ReconcileTag, t))
+		}
+		create := ReconcileAction{Type: ReconcileCreate, Resource: ReconcileServer, Key: key, DependsOn: deps,
+			run: func(c *Client, refs map[string]string) (string, error) {
+				attrs := ServerCreateAttributes{
+					Project:         projectRef(refs),
+					Plan:            sv.Plan,
+					Site:            sv.Site,
+					OperatingSystem: sv.OperatingSystem,
+					Hostname:        sv.Hostname,
+					Billing:         sv.Billing,
+				}
+				for _, k := range sv.SSHKeys {
+					attrs.SSHKeys = append(attrs.SSHKeys, refs[reconcileKey(ReconcileSSHKey, p.Name, k)])
+				}
+				server, _, err := c.Servers.Create(&ServerCreateRequest{Data: ServerCreateData{Type: "servers", Attributes: attrs}})
+				if server == nil {
+					return "", err
+				}
+				if err == nil && len(sv.Tags) > 0 {
+					_, _, err = c.Servers.Update(server.ID, serverTagsUpdate(server.ID, sv, refs))
+				}
+				return server.ID, err
+			}}
+
+		cur, ok := state.servers[sv.Hostname]
+		if !ok {
+			creates = append(creates, create)
+			continue
+		}
+		if reason := serverReplaceReason(sv, cur); reason != "" {
+			replaced[sv.Hostname] = true
+			create.Reason = reason
+			assignmentDeletes := serverAssignmentDeletes(p.Name, state, sv.Hostname)
+			// the delete has its own key so that a failed delete skips the
+			// create instead of deploying a second server with the hostname
+			deleteServer := deleteServerAction(p.Name, cur, reason)
+			deleteServer.Key = serverDeleteKey(p.Name, sv.Hostname)
+			for _, a := range assignmentDeletes {
+				deleteServer.DependsOn = append(deleteServer.DependsOn, a.Key)
+			}
+			create.DependsOn = append(create.DependsOn, deleteServer.Key)
+			creates = append(creates, assignmentDeletes...)
+			creates = append(creates, deleteServer, create)
+			continue
+		}
+		if !sameStrings(sv.Tags, embedTagNames(cur.Tags)) {
+			id := cur.ID
+			creates = append(creates, ReconcileAction{Type: ReconcileUpdate, Resource: ReconcileServer, Key: key, ID: id, DependsOn: deps, Reason: "tags changed",
+				run: func(c *Client, refs map[string]string) (string, error) {
+					_, _, err := c.Servers.Update(id, serverTagsUpdate(id, sv, refs))
+					return id, err
+				}})
+		}
+	}
+	for hostname, cur := range state.servers {
+		if !wantServers[hostname] {
+			deletes = append(deletes, deleteServerAction(p.Name, cur, "not in spec"))
+		}
+	}
+
+	wantVlans := map[string]bool{}
+	for _, vn := range p.VirtualNetworks {
+		vn := vn
+		wantVlans[vn.Description] = true
+		key := reconcileKey(ReconcileVirtualNetwork, p.Name, vn.Description)
+		if _, ok := state.vlans[vn.Description]; !ok {
+			creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileVirtualNetwork, Key: key, DependsOn: []string{projectKey},
+				run: func(c *Client, refs map[string]string) (string, error) {
+					attrs := VirtualNetworkCreateAttributes{Description: vn.Description, Site: vn.Site, Project: projectRef(refs)}
+					network, _, err := c.VirtualNetworks.Create(&VirtualNetworkCreateRequest{Data: VirtualNetworkCreateData{Type: "virtual_network", Attributes: attrs}})
+					var refetchErr *VirtualNetworkRefetchError
+					if err != nil && !errors.As(err, &refetchErr) {
+						return "", err
+					}
+					// the network exists even when it couldn't be fetched back
+					return network.ID, nil
+				}})
+		}
+
+		assigned := map[string]VlanAssignment{}
+		for _, a := range state.vlanAssignments[vn.Description] {
+			assigned[a.ServerHostname] = a
+		}
+		for hn := range replaced {
+			delete(assigned, hn)
+		}
+		for _, hn := range vn.Servers {
+			hn := hn
+			if _, ok := assigned[hn]; ok {
+				delete(assigned, hn)
+				continue
+			}
+			serverKey := reconcileKey(ReconcileServer, p.Name, hn)
+			creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileVlanAssignment, Key: reconcileKey(ReconcileVlanAssignment, p.Name, vn.Description, hn), DependsOn: []string{key, serverKey},
+				run: func(c *Client, refs map[string]string) (string, error) {
+					attrs := VlanAssignAttributes{ServerID: refs[serverKey], VirtualNetworkID: refs[key]}
+					assignment, _, err := c.VlanAssignments.Assign(&VlanAssignRequest{Data: VlanAssignData{Type: "virtual_network_assignment", Attributes: attrs}})
+					if err != nil {
+						return "", err
+					}
+					return assignment.ID, nil
+				}})
+		}
+		for hn, a := range assigned {
+			deletes = append(deletes, deleteVlanAssignmentAction(p.Name, vn.Description, hn, a.ID, "not in spec"))
+		}
+	}
+	for desc, cur := range state.vlans {
+		if wantVlans[desc] {
+			continue
+		}
+		for _, a := range state.vlanAssignments[desc] {
+			if !replaced[a.ServerHostname] {
+				deletes = append(deletes, deleteVlanAssignmentAction(p.Name, desc, a.ServerHostname, a.ID, "not in spec"))
+			}
+		}
+		id := cur.ID
+		deletes = append(deletes, ReconcileAction{Type: ReconcileDelete, Resource: ReconcileVirtualNetwork, Key: reconcileKey(ReconcileVirtualNetwork, p.Name, desc), ID: id, Reason: "not in spec",
+			run: func(c *Client, refs map[string]string) (string, error) {
+				_, err := c.VirtualNetworks.Delete(id)
+				return id, err
+			}})
+	}
+
+	wantFirewalls := map[string]bool{}
+	for _, fw := range p.Firewalls {
+		fw := fw
+		wantFirewalls[fw.Name] = true
+		key := reconcileKey(ReconcileFirewall, p.Name, fw.Name)
+		cur, ok := state.firewalls[fw.Name]
+		switch {
+		case !ok:
+			creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileFirewall, Key: key, DependsOn: []string{projectKey},
+				run: func(c *Client, refs map[string]string) (string, error) {
+					attrs := FirewallCreateAttributes{Name: fw.Name, Project: projectRef(refs), Rules: fw.Rules}
+					firewall, _, err := c.Firewalls.Create(&FirewallCreateRequest{Data: FirewallCreateData{Type: "firewalls", Attributes: attrs}})
+					if err != nil {
+						return "", err
+					}
+					return firewall.ID, nil
+				}})
+		case !sameFirewallRules(fw.Rules, cur.Rules):
+			id := cur.ID
+			creates = append(creates, ReconcileAction{Type: ReconcileUpdate, Resource: ReconcileFirewall, Key: key, ID: id, Reason: "rules changed",
+				run: func(c *Client, refs map[string]string) (string, error) {
+					// Sync sends an empty rule list when every rule is removed
+					_, _, err := c.Firewalls.Sync(id, fw.Rules)
+					return id, err
+				}})
+		}
+
+		assigned := map[string]FirewallAssignment{}
+		for _, a := range state.firewallAssignments[fw.Name] {
+			assigned[a.Server.Hostname] = a
+		}
+		for hn := range replaced {
+			delete(assigned, hn)
+		}
+		for _, hn := range fw.Servers {
+			if _, ok := assigned[hn]; ok {
+				delete(assigned, hn)
+				continue
+			}
+			serverKey := reconcileKey(ReconcileServer, p.Name, hn)
+			creates = append(creates, ReconcileAction{Type: ReconcileCreate, Resource: ReconcileFirewallAssignment, Key: reconcileKey(ReconcileFirewallAssignment, p.Name, fw.Name, hn), DependsOn: []string{key, serverKey},
+				run: func(c *Client, refs map[string]string) (string, error) {
+					req := &FirewallAssignmentCreateRequest{Data: FirewallAssignmentCreateData{Attributes: FirewallAssignmentCreateAttributes{Server: refs[serverKey]}}}
+					assignment, _, err := c.Firewalls.CreateAssignment(refs[key], req)
+					if err != nil {
+						return "", err
+					}
+					return assignment.ID, nil
+				}})
+		}
+		for hn, a := range assigned {
+			deletes = append(deletes, deleteFirewallAssignmentAction(p.Name, fw.Name, hn, cur.ID, a.ID, "not in spec"))
+		}
+	}
+	for name, cur := range state.firewalls {
+		if wantFirewalls[name] {
+			continue
+		}
+		for _, a := range state.firewallAssignments[name] {
+			if !replaced[a.Server.Hostname] {
+				deletes = append(deletes, deleteFirewallAssignmentAction(p.Name, name, a.Server.Hostname, cur.ID, a.ID, "not in spec"))
+			}
+		}
+		id := cur.ID
+		deletes = append(deletes, ReconcileAction{Type: ReconcileDelete, Resource: ReconcileFirewall, Key: reconcileKey(ReconcileFirewall, p.Name, name), ID: id, Reason: "not in spec",
+			run: func(c *Client, refs map[string]string) (string, error) {
+				_, err := c.Firewalls.Delete(id)
+				return id, err
+			}})
+	}
+
+	return creates, deletes
+}
+
+func deleteSSHKeyAction(project string, k SSHKey, reason string) ReconcileAction {
+	projectKey := reconcileKey(ReconcileProject, project)
+	return ReconcileAction{Type: ReconcileDelete, Resource: ReconcileSSHKey, Key: reconcileKey(ReconcileSSHKey, project, k.Name), ID: k.ID, Reason: reason,
+		run: func(c *Client, refs map[string]string) (string, error) {
+			_, err := c.SSHKeys.Delete(k.ID, refs[projectKey])
+			return k.ID, err
+		}}
+}
+
+func deleteServerAction(project string, s Server, reason string) ReconcileAction {
+	return ReconcileAction{Type: ReconcileDelete, Resource: ReconcileServer, Key: reconcileKey(ReconcileServer, project, s.Hostname), ID: s.ID, Reason: reason,
+		run: func(c *Client, refs map[string]string) (string, error) {
+			if s.Locked {
+				return s.ID, fmt.Errorf("server %s is locked", s.Hostname)
+			}
+			_, err := c.Servers.Delete(s.ID)
+			return s.ID, err
+		}}
+}
+
+// serverAssignmentDeletes returns the actions deleting the vlan and firewall
+// assignments of the server, sorted by key
+func serverAssignmentDeletes(project string, state *projectState, hostname string) []ReconcileAction {
+	var actions []ReconcileAction
+	for desc, assignments := range state.vlanAssignments {
+		for _, a := range assignments {
+			if a.ServerHostname == hostname {
+				actions = append(actions, deleteVlanAssignmentAction(project, desc, hostname, a.ID, "server replaced"))
+			}
+		}
+	}
+	for name, assignments := range state.firewallAssignments {
+		for _, a := range assignments {
+			if a.Server.Hostname == hostname {
+				actions = append(actions, deleteFirewallAssignmentAction(project, name, hostname, state.firewalls[name].ID, a.ID, "server replaced"))
+			}
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Key < actions[j].Key })
+	return actions
+}
+
+func deleteVlanAssignmentAction(project, vlan, hostname, id, reason string) ReconcileAction {
+	return ReconcileAction{Type: ReconcileDelete, Resource: ReconcileVlanAssignment, Key: reconcileKey(ReconcileVlanAssignment, project, vlan, hostname), ID: id, Reason: reason,
+		run: func(c *Client, refs map[string]string) (string, error) {
+			_, err := c.VlanAssignments.Delete(id)
+			return id, err
+		}}
+}
+
+func deleteFirewallAssignmentAction(project, firewall, hostname, firewallID, id, reason string) ReconcileAction {
+	return ReconcileAction{Type: ReconcileDelete, Resource: ReconcileFirewallAssignment, Key: reconcileKey(ReconcileFirewallAssignment, project, firewall, hostname), ID: id, Reason: reason,
+		run: func(c *Client, refs map[string]string) (string, error) {
+			_, err := c.Firewalls.DeleteAssignment(firewallID, id)
+			return id, err
+		}}
+}
+
+// serverReplaceReason returns why an existing server must be redeployed to
+// match the spec, or "" if it can be kept
+func serverReplaceReason(sv FleetServer, cur Server) string {
+	var changed []string
+	if sv.Plan != "" && sv.Plan != cur.Plan.Slug {
+		changed = append(changed, "plan")
+	}
+	if sv.Site != "" && !strings.EqualFold(sv.Site, cur.Region.Site.Slug) {
+		changed = append(changed, "site")
+	}
+	if sv.OperatingSystem != "" && sv.OperatingSystem != cur.OperatingSystem.Slug {
+		changed = append(changed, "operating system")
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	return strings.Join(changed, ", ") + " changed"
+}
+
+// serverTagsUpdate sets the tags of the server to those of the spec, a non
+// nil empty list removes them all
+func serverTagsUpdate(id string, sv FleetServer, refs map[string]string) *ServerUpdateRequest {
+	attrs := ServerUpdateAttributes{Hostname: sv.Hostname, Tags: []string{}}
+	for _, t := range sv.Tags {
+		attrs.Tags = append(attrs.Tags, refs[reconcileKey(ReconcileTag, t)])
+	}
+	return &ServerUpdateRequest{Data: ServerUpdateData{ID: id, Type: "servers", Attributes: attrs}}
+}
+
+func embedTagNames(tags []EmbedTag) []string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// sameStrings reports whether a and b hold the same values, in any order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameFirewallRules compares the non default rules of a firewall, in any
+// order and after normalization
+func sameFirewallRules(want, got []FirewallRule) bool {
+	diff, err := DiffFirewallRules(got, want)
+	return err == nil && diff.Empty()
+}
+
+// Apply runs the actions of plan in order. An action whose dependencies
+// failed is skipped. The returned results hold one entry per action that was
+// run or skipped.
+func (r *Reconciler) Apply(plan *ReconcilePlan, opts *ReconcileApplyOptions) ([]ReconcileResult, error) {
+	if opts == nil {
+		opts = &ReconcileApplyOptions{}
+	}
+	deletes := plan.Count(ReconcileDelete)
+	if deletes > 0 && !opts.AllowDeletes {
+		return nil, &ReconcileGuardrailError{Reason: fmt.Sprintf("plan deletes %d resources and deletes are not allowed", deletes)}
+	}
+	if opts.MaxDeletes > 0 && deletes > opts.MaxDeletes {
+		return nil, &ReconcileGuardrailError{Reason: fmt.Sprintf("plan deletes %d resources, more than the maximum of %d", deletes, opts.MaxDeletes)}
+	}
+
+	refs := map[string]string{}
+	for k, v := range plan.refs {
+		refs[k] = v
+	}
+	failed := map[string]bool{}
+
+	var results []ReconcileResult
+	var firstErr error
+	for _, a := range plan.Actions {
+		skip := false
+		for _, dep := range a.DependsOn {
+			if failed[dep] {
+				skip = true
+			}
+		}
+		if skip {
+			failed[a.Key] = true
+			results = append(results, ReconcileResult{Action: a, Skipped: true})
+			continue
+		}
+
+		id, err := a.run(r.client, refs)
+		results = append(results, ReconcileResult{Action: a, ID: id, Err: err})
+		if err != nil {
+			failed[a.Key] = true
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s %s: %w", a.Type, a.Key, err)
+			}
+			if !opts.ContinueOnError {
+				return results, firstErr
+			}
+			continue
+		}
+		if a.Type == ReconcileDelete {
+			delete(refs, a.Key)
+		} else {
+			refs[a.Key] = id
+		}
+	}
+	return results, firstErr
+}
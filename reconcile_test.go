@@ -0,0 +1,342 @@
+package latitude
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testFleetSpec = `
+tags:
+  - name: web
+projects:
+  - name: shop
+    ssh_keys:
+      - name: deploy
+        public_key: ssh-ed25519 AAAA deploy
+    servers:
+      - hostname: web-1
+        plan: c2-small-x86
+        site: SAO
+        operating_system: ubuntu_24_04_x64_lts
+        ssh_keys: [deploy]
+        tags: [web]
+    virtual_networks:
+      - description: backend
+        site: SAO
+        servers: [web-1]
+    firewalls:
+      - name: edge
+        rules:
+          - from: ANY
+            to: ANY
+            port: "443"
+            protocol: TCP
+        servers: [web-1]
+`
+
+func TestLoadFleetSpecValidation(t *testing.T) {
+	spec, err := LoadFleetSpec(strings.NewReader(testFleetSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, spec.Projects[0].Firewalls[0].Rules[0].Port, "443", "Firewall rule port")
+
+	_, err = LoadFleetSpec(strings.NewReader(`
+projects:
+  - name: shop
+    servers:
+      - hostname: web-1
+        ssh_keys: [missing]
+    firewalls:
+      - name: edge
+        servers: [web-2]
+`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	assertEqual(t, len(verr.Violations), 2, "Fleet spec violations")
+}
+
+func TestReconcilePlanAndApply(t *testing.T) {
+	var writes []string
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writes = append(writes, r.Method+" "+r.URL.Path)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /tags":
+			fmt.Fprint(w, `{"data":[{"id":"tag_web","type":"tags","attributes":{"name":"web"}}]}`)
+		case "GET /projects":
+			fmt.Fprint(w, `{"data":[{"id":"proj_1","type":"projects","attributes":{"name":"shop"}}]}`)
+		case "GET /projects/proj_1/ssh_keys":
+			fmt.Fprint(w, `{"data":[{"id":"ssh_1","type":"ssh_keys","attributes":{"name":"deploy","public_key":"ssh-ed25519 AAAA deploy"}}]}`)
+		case "GET /servers":
+			fmt.Fprint(w, `{"data":[{"id":"sv_old","type":"servers","attributes":{"hostname":"old","plan":{"slug":"c2-small-x86"}}}]}`)
+		case "GET /virtual_networks", "GET /virtual_networks/assignments", "GET /firewalls":
+			fmt.Fprint(w, `{"data":[]}`)
+		case "POST /servers":
+			fmt.Fprint(w, `{"data":{"id":"sv_web","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "GET /servers/sv_web":
+			fmt.Fprint(w, `{"data":{"id":"sv_web","type":"servers","attributes":{"status":"on"}}}`)
+		case "POST /virtual_networks":
+			fmt.Fprint(w, `{"data":{"id":"vlan_1","type":"virtual_network","attributes":{"description":"backend"}}}`)
+		case "GET /virtual_networks/vlan_1":
+			fmt.Fprint(w, `{"data":{"id":"vlan_1","type":"virtual_networks","attributes":{"description":"backend"}}}`)
+		case "POST /virtual_networks/assignments":
+			fmt.Fprint(w, `{"data":{"id":"vnasg_1","type":"virtual_network_assignment","attributes":{}}}`)
+		case "POST /firewalls":
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"edge"}}}`)
+		case "POST /firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":{"id":"fwasg_1","type":"firewall_server","attributes":{}}}`)
+		case "PATCH /servers/sv_web":
+			fmt.Fprint(w, `{"data":{"id":"sv_web","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "DELETE /servers/sv_old":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	interval := serverPollInterval
+	serverPollInterval = 0
+	defer func() { serverPollInterval = interval }()
+
+	spec, err := LoadFleetSpec(strings.NewReader(testFleetSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReconciler(c)
+	plan, err := r.Plan(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := plan.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `+ create server/shop/web-1
++ create virtual_network/shop/backend
++ create vlan_assignment/shop/backend/web-1
++ create firewall/shop/edge
++ create firewall_assignment/shop/edge/web-1
+- delete server/shop/old (not in spec)
+Plan: 5 to create, 0 to update, 1 to delete.
+`
+	assertEqual(t, out.String(), want, "Printed plan")
+
+	if _, err := r.Apply(plan, nil); err == nil {
+		t.Fatal("expected deletes to be refused by default")
+	}
+	assertEqual(t, len(writes), 0, "Writes before guardrail")
+
+	results, err := r.Apply(plan, &ReconcileApplyOptions{AllowDeletes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(results), 6, "Applied actions")
+	assertEqual(t, writes[0], "POST /servers", "First write")
+	assertEqual(t, writes[len(writes)-1], "DELETE /servers/sv_old", "Last write")
+}
+
+// serverReplaceMock serves a project whose web-1 server runs another plan
+// than the spec and is assigned to the backend vlan and edge firewall
+func serverReplaceMock(t *testing.T, locked bool, writes *[]string, assignedServers map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			*writes = append(*writes, r.Method+" "+r.URL.Path)
+		}
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/assignments") {
+			var body struct {
+				Data struct {
+					Attributes struct {
+						ServerID string `json:"server_id"`
+					} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			assignedServers[r.URL.Path] = body.Data.Attributes.ServerID
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /tags":
+			fmt.Fprint(w, `{"data":[{"id":"tag_web","type":"tags","attributes":{"name":"web"}}]}`)
+		case "GET /projects":
+			fmt.Fprint(w, `{"data":[{"id":"proj_1","type":"projects","attributes":{"name":"shop"}}]}`)
+		case "GET /projects/proj_1/ssh_keys":
+			fmt.Fprint(w, `{"data":[{"id":"ssh_1","type":"ssh_keys","attributes":{"name":"deploy","public_key":"ssh-ed25519 AAAA deploy"}}]}`)
+		case "GET /servers":
+			fmt.Fprintf(w, `{"data":[{"id":"sv_old","type":"servers","attributes":{"hostname":"web-1","plan":{"slug":"c2-medium-x86"},"region":{"site":{"slug":"SAO"}},"operating_system":{"slug":"ubuntu_24_04_x64_lts"},"locked":%t,"tags":[{"id":"tag_web","name":"web"}]}}]}`, locked)
+		case "GET /virtual_networks":
+			fmt.Fprint(w, `{"data":[{"id":"vlan_1","type":"virtual_networks","attributes":{"description":"backend"}}]}`)
+		case "GET /virtual_networks/assignments":
+			fmt.Fprint(w, `{"data":[{"id":"vnasg_old","type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","server":{"id":"sv_old","hostname":"web-1"}}}]}`)
+		case "GET /firewalls":
+			fmt.Fprint(w, `{"data":[{"id":"fw_1","type":"firewalls","attributes":{"name":"edge","project":{"id":"proj_1"},"rules":[{"from":"ANY","to":"ANY","port":"443","protocol":"TCP"}]}}]}`)
+		case "GET /firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":[{"id":"fwasg_old","type":"firewall_server","attributes":{"server":{"id":"sv_old","hostname":"web-1"}}}]}`)
+		case "DELETE /virtual_networks/assignments/vnasg_old", "DELETE /firewalls/fw_1/assignments/fwasg_old", "DELETE /servers/sv_old":
+			w.WriteHeader(http.StatusNoContent)
+		case "POST /servers":
+			fmt.Fprint(w, `{"data":{"id":"sv_new","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "GET /servers/sv_new":
+			fmt.Fprint(w, `{"data":{"id":"sv_new","type":"servers","attributes":{"status":"on"}}}`)
+		case "PATCH /servers/sv_new":
+			fmt.Fprint(w, `{"data":{"id":"sv_new","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "POST /virtual_networks/assignments":
+			fmt.Fprint(w, `{"data":{"id":"vnasg_new","type":"virtual_network_assignment","attributes":{}}}`)
+		case "POST /firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":{"id":"fwasg_new","type":"firewall_server","attributes":{}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestReconcileServerReplaceRecreatesAssignments(t *testing.T) {
+	var writes []string
+	assignedServers := map[string]string{}
+	c := setupMock(t, serverReplaceMock(t, false, &writes, assignedServers))
+	interval := serverPollInterval
+	serverPollInterval = 0
+	defer func() { serverPollInterval = interval }()
+
+	spec, err := LoadFleetSpec(strings.NewReader(testFleetSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReconciler(c)
+	plan, err := r.Plan(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := plan.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `- delete firewall_assignment/shop/edge/web-1 (server replaced)
+- delete vlan_assignment/shop/backend/web-1 (server replaced)
+- delete server-delete/shop/web-1 (plan changed)
++ create server/shop/web-1 (plan changed)
++ create vlan_assignment/shop/backend/web-1
++ create firewall_assignment/shop/edge/web-1
+Plan: 3 to create, 0 to update, 3 to delete.
+`
+	assertEqual(t, out.String(), want, "Printed plan")
+
+	if _, err := r.Apply(plan, &ReconcileApplyOptions{AllowDeletes: true}); err != nil {
+		t.Fatal(err)
+	}
+	wantWrites := []string{
+		"DELETE /firewalls/fw_1/assignments/fwasg_old",
+		"DELETE /virtual_networks/assignments/vnasg_old",
+		"DELETE /servers/sv_old",
+		"POST /servers",
+		"PATCH /servers/sv_new",
+		"POST /virtual_networks/assignments",
+		"POST /firewalls/fw_1/assignments",
+	}
+	assertEqual(t, strings.Join(writes, "\n"), strings.Join(wantWrites, "\n"), "Writes")
+	assertEqual(t, assignedServers["/virtual_networks/assignments"], "sv_new", "VLAN assignment server")
+	assertEqual(t, assignedServers["/firewalls/fw_1/assignments"], "sv_new", "Firewall assignment server")
+}
+
+func TestReconcileClearsTagsAndRules(t *testing.T) {
+	bodies := map[string]string{}
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			b, _ := io.ReadAll(r.Body)
+			bodies[r.URL.Path] = string(b)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /tags":
+			fmt.Fprint(w, `{"data":[{"id":"tag_web","type":"tags","attributes":{"name":"web"}}]}`)
+		case "GET /projects":
+			fmt.Fprint(w, `{"data":[{"id":"proj_1","type":"projects","attributes":{"name":"shop"}}]}`)
+		case "GET /projects/proj_1/ssh_keys", "GET /virtual_networks", "GET /firewalls/fw_1/assignments":
+			fmt.Fprint(w, `{"data":[]}`)
+		case "GET /servers":
+			fmt.Fprint(w, `{"data":[{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","tags":[{"id":"tag_web","name":"web"}]}}]}`)
+		case "GET /firewalls":
+			fmt.Fprint(w, `{"data":[{"id":"fw_1","type":"firewalls","attributes":{"name":"edge","project":{"id":"proj_1"},"rules":[{"from":"ANY","to":"ANY","port":"443","protocol":"TCP"}]}}]}`)
+		case "GET /firewalls/fw_1":
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"edge","project":{"id":"proj_1"},"rules":[{"from":"ANY","to":"ANY","port":"443","protocol":"TCP"}]}}}`)
+		case "PATCH /servers/sv_1":
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "PATCH /firewalls/fw_1":
+			fmt.Fprint(w, `{"data":{"id":"fw_1","type":"firewalls","attributes":{"name":"edge"}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	spec, err := LoadFleetSpec(strings.NewReader(`
+projects:
+  - name: shop
+    servers:
+      - hostname: web-1
+    firewalls:
+      - name: edge
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReconciler(c)
+	plan, err := r.Plan(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, plan.Count(ReconcileUpdate), 2, "Planned updates")
+
+	if _, err := r.Apply(plan, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(bodies["/servers/sv_1"], `"tags":[]`) {
+		t.Errorf("expected the server update to clear the tags, sent %s", bodies["/servers/sv_1"])
+	}
+	if !strings.Contains(bodies["/firewalls/fw_1"], `"rules":[]`) {
+		t.Errorf("expected the firewall update to clear the rules, sent %s", bodies["/firewalls/fw_1"])
+	}
+}
+
+func TestReconcileLockedServerReplace(t *testing.T) {
+	var writes []string
+	c := setupMock(t, serverReplaceMock(t, true, &writes, map[string]string{}))
+
+	spec, err := LoadFleetSpec(strings.NewReader(testFleetSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReconciler(c)
+	plan, err := r.Plan(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := r.Apply(plan, &ReconcileApplyOptions{AllowDeletes: true, ContinueOnError: true})
+	if err == nil {
+		t.Fatal("expected the locked server error")
+	}
+	// the old server can't be deleted, so no second web-1 is deployed
+	wantWrites := []string{
+		"DELETE /firewalls/fw_1/assignments/fwasg_old",
+		"DELETE /virtual_networks/assignments/vnasg_old",
+	}
+	assertEqual(t, strings.Join(writes, "\n"), strings.Join(wantWrites, "\n"), "Writes")
+	for _, res := range results {
+		if res.Action.Type == ReconcileCreate {
+			assertEqual(t, res.Skipped, true, "Skipped "+res.Action.Key)
+		}
+	}
+}
@@ -53,7 +53,8 @@ type Region struct {
 
 // RegionServiceOp implements RegionService
 type RegionServiceOp struct {
-	client requestDoer
+	client  requestDoer
+	catalog *catalogCache
 }
 
 // Flatten latitude API data structures
@@ -77,8 +78,17 @@ func NewFlatRegionList(rd []RegionData) []Region {
 	return res
 }
 
-// List returns a list of regions
-func (s *RegionServiceOp) List(opts *ListOptions) (regions []Region, resp *Response, err error) {
+// List returns a list of regions. Unfiltered lists are served from the catalog
+// cache when it is enabled, see Client.EnableCatalogCache.
+func (s *RegionServiceOp) List(opts *ListOptions) ([]Region, *Response, error) {
+	if opts == nil && s.catalog.isEnabled() {
+		return catalogList(s.catalog, CatalogRegions, func() ([]Region, *Response, error) { return s.list(nil) })
+	}
+	return s.list(opts)
+}
+
+// list fetches the regions from the API
+func (s *RegionServiceOp) list(opts *ListOptions) (regions []Region, resp *Response, err error) {
 	apiPathQuery := opts.WithQuery(regionBasePath)
 
 	for {
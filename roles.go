@@ -12,7 +12,8 @@ type RoleService interface {
 
 // RoleServiceOp implements RoleService
 type RoleServiceOp struct {
-	client requestDoer
+	client  requestDoer
+	catalog *catalogCache
 }
 
 type AvailableRole string
@@ -77,7 +78,17 @@ func (s *RoleServiceOp) Get(RoleID string, opts *GetOptions) (*Role, *Response,
 	return &flatRole, resp, err
 }
 
+// List returns a list of roles. Unfiltered lists are served from the catalog
+// cache when it is enabled, see Client.EnableCatalogCache.
 func (s *RoleServiceOp) List(opts *ListOptions) ([]Role, *Response, error) {
+	if opts == nil && s.catalog.isEnabled() {
+		return catalogList(s.catalog, CatalogRoles, func() ([]Role, *Response, error) { return s.list(nil) })
+	}
+	return s.list(opts)
+}
+
+// list fetches the roles from the API
+func (s *RoleServiceOp) list(opts *ListOptions) ([]Role, *Response, error) {
 	apiPathQuery := opts.WithQuery(roleBasePath)
 	roles := []Role{}
 
@@ -1,6 +1,8 @@
 package latitude
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"path"
 	"time"
@@ -12,12 +14,42 @@ type ServerService interface {
 	List(ProjectID string, opts *ListOptions) ([]Server, *Response, error)
 	Get(ServerID string, opts *GetOptions) (*Server, *Response, error)
 	Create(*ServerCreateRequest) (*Server, *Response, error)
+	CreateContext(ctx context.Context, createRequest *ServerCreateRequest) (*Server, *Response, error)
 	Update(string, *ServerUpdateRequest) (*Server, *Response, error)
 	Delete(serverID string) (*Response, error)
 	Reinstall(serverID string, reinstallRequest *ServerReinstallRequest) (*Response, error)
 	Lock(serverID string) (*Server, *Response, error)
 	Unlock(serverID string) (*Server, *Response, error)
-}
+	EnterRescueMode(serverID string) (*Response, error)
+	ExitRescueMode(serverID string) (*Response, error)
+	WaitForStatus(serverID string, status ServerStatus) (*Server, error)
+	WaitForStatusContext(ctx context.Context, serverID string, status ServerStatus) (*Server, error)
+	ScheduleDeletion(serverID string) (*ServerScheduledDeletion, *Response, error)
+	UnscheduleDeletion(serverID string) (*Response, error)
+	BulkCreate(requests []ServerCreateRequest, opts *BulkCreateOptions) (BulkCreateResults, error)
+	CreateWithPlacement(createRequest *ServerCreateRequest, candidates []PlacementCandidate) (*Server, *Response, error)
+}
+
+// ServerStatus is the power and provisioning state reported for a server
+type ServerStatus string
+
+const (
+	ServerStatusOn               ServerStatus = "on"
+	ServerStatusOff              ServerStatus = "off"
+	ServerStatusUnknown          ServerStatus = "unknown"
+	ServerStatusDeploying        ServerStatus = "deploying"
+	ServerStatusDiskErasing      ServerStatus = "disk_erasing"
+	ServerStatusFailed           ServerStatus = "failed"
+	ServerStatusFailedDeployment ServerStatus = "failed_deployment"
+	ServerStatusRescueMode       ServerStatus = "rescue_mode"
+)
+
+var (
+	// serverPollInterval and serverPollRetries bound how long the status
+	// waiters poll, 15 minutes = 180 * 15sec-retry
+	serverPollInterval = 15 * time.Second
+	serverPollRetries  = 180
+)
 
 type ServerRoot struct {
 	Data ServerData `json:"data"`
@@ -76,32 +108,60 @@ type ServerGetData struct {
 	ID         string              `json:"id"`
 	Type       string              `json:"type"`
 	Attributes ServerGetAttributes `json:"attributes"`
+
+	// RawAttributes keeps the attributes object as returned by the API,
+	// including any attribute not modelled by ServerGetAttributes
+	RawAttributes json.RawMessage `json:"-"`
+}
+
+func (sd *ServerGetData) UnmarshalJSON(b []byte) error {
+	var data struct {
+		ID         string          `json:"id"`
+		Type       string          `json:"type"`
+		Attributes json.RawMessage `json:"attributes"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	sd.ID = data.ID
+	sd.Type = data.Type
+	sd.RawAttributes = data.Attributes
+	if len(data.Attributes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data.Attributes, &sd.Attributes)
 }
 
 type ServerGetAttributes struct {
-	Hostname        string                `json:"hostname"`
-	Label           string                `json:"label"`
-	Price           float64               `json:"price"`
-	Role            string                `json:"role"`
-	PrimaryIPv4     string                `json:"primary_ipv4"`
-	Status          string                `json:"status"`
-	IMPIStatus      string                `json:"impi_status"`
-	Site            string                `json:"site"`
-	InstanceType    string                `json:"instance_type"`
-	Locked          bool                  `json:"locked"`
-	CreatedAt       string                `json:"created_at"`
-	Specs           ServerSpecs           `json:"specs"`
-	Project         ServerProject         `json:"project"`
-	OperatingSystem ServerOperatingSystem `json:"operating_system"`
-	Plan            ServerPlan            `json:"plan"`
-	Region          ServerRegion          `json:"region"`
-	Team            ServerTeam            `json:"team"`
-	Tags            []EmbedTag            `json:"tags"`
+	Hostname            string                `json:"hostname"`
+	Label               string                `json:"label"`
+	Price               float64               `json:"price"`
+	Role                string                `json:"role"`
+	PrimaryIPv4         string                `json:"primary_ipv4"`
+	Status              string                `json:"status"`
+	IMPIStatus          string                `json:"ipmi_status"`
+	Site                string                `json:"site"`
+	InstanceType        string                `json:"instance_type"`
+	Locked              bool                  `json:"locked"`
+	CreatedAt           Timestamp             `json:"created_at"`
+	ScheduledDeletionAt *Timestamp            `json:"scheduled_deletion_at"`
+	Specs               ServerSpecs           `json:"specs"`
+	Project             ServerProject         `json:"project"`
+	OperatingSystem     ServerOperatingSystem `json:"operating_system"`
+	Plan                ServerPlan            `json:"plan"`
+	Region              ServerRegion          `json:"region"`
+	Team                ServerTeam            `json:"team"`
+	Tags                []EmbedTag            `json:"tags"`
 }
 
 // ServerCreateRequest type used to create a Latitude server
 type ServerCreateRequest struct {
 	Data ServerCreateData `json:"data"`
+
+	// BudgetOverride creates the server even if it would exceed the budget
+	// set with Client.SetBudget
+	BudgetOverride bool `json:"-"`
 }
 
 type ServerCreateData struct {
@@ -133,11 +193,27 @@ type ServerUpdateData struct {
 	Attributes ServerUpdateAttributes `json:"attributes"`
 }
 
+// ServerUpdateAttributes are the attributes of a server update. A nil Tags
+// leaves the tags untouched, an empty non-nil one removes them all.
 type ServerUpdateAttributes struct {
 	Hostname string   `json:"hostname"`
 	Billing  string   `json:"billing,omitempty"`
 	Tags     []string `json:"tags,omitempty"`
 }
+
+// MarshalJSON sends an empty non-nil Tags, which omitempty would drop
+func (a ServerUpdateAttributes) MarshalJSON() ([]byte, error) {
+	attrs := struct {
+		Hostname string    `json:"hostname"`
+		Billing  string    `json:"billing,omitempty"`
+		Tags     *[]string `json:"tags,omitempty"`
+	}{Hostname: a.Hostname, Billing: a.Billing}
+	if a.Tags != nil {
+		attrs.Tags = &a.Tags
+	}
+	return json.Marshal(attrs)
+}
+
 type ServerReinstallRequest struct {
 	Data ServerReinstallData `json:"data"`
 }
@@ -159,29 +235,99 @@ type ServerReinstallAttributes struct {
 // ServerServiceOp implements ServerService
 type ServerServiceOp struct {
 	client requestDoer
+	budget *budgetGuard
 }
 
 type Server struct {
-	ID              string                `json:"id"`
-	Hostname        string                `json:"hostname"`
-	Label           string                `json:"label"`
-	Role            string                `json:"role"`
-	Status          string                `json:"status"`
-	PrimaryIPv4     string                `json:"primary_ipv4"`
-	IMPIStatus      string                `json:"impi_status"`
-	Locked          bool                  `json:"locked"`
-	CreatedAt       string                `json:"created_at"`
-	Specs           ServerSpecs           `json:"specs"`
-	Project         ServerProject         `json:"project"`
-	OperatingSystem ServerOperatingSystem `json:"operating_system"`
-	Plan            ServerPlan            `json:"plan"`
-	Region          ServerRegion          `json:"region"`
-	Tags            []EmbedTag            `json:"tags"`
+	ID          string  `json:"id"`
+	Hostname    string  `json:"hostname"`
+	Label       string  `json:"label"`
+	Price       float64 `json:"price"`
+	Role        string  `json:"role"`
+	Status      string  `json:"status"`
+	PrimaryIPv4 string  `json:"primary_ipv4"`
+	// IMPIStatus keeps its historical spelling, it holds the IPMI status
+	IMPIStatus          string                `json:"ipmi_status"`
+	Site                string                `json:"site"`
+	InstanceType        string                `json:"instance_type"`
+	Locked              bool                  `json:"locked"`
+	CreatedAt           Timestamp             `json:"created_at"`
+	ScheduledDeletionAt *Timestamp            `json:"scheduled_deletion_at"`
+	Specs               ServerSpecs           `json:"specs"`
+	Project             ServerProject         `json:"project"`
+	OperatingSystem     ServerOperatingSystem `json:"operating_system"`
+	Plan                ServerPlan            `json:"plan"`
+	Region              ServerRegion          `json:"region"`
+	Team                ServerTeam            `json:"team"`
+	Tags                []EmbedTag            `json:"tags"`
+
+	rawAttributes json.RawMessage
+}
+
+// ServerScheduledDeletion is a pending deletion of a server at the end of its billing period
+type ServerScheduledDeletion struct {
+	ID                  string    `json:"id"`
+	ServerID            string    `json:"server_id"`
+	ScheduledDeletionAt Timestamp `json:"scheduled_deletion_at"`
+}
+
+type ServerScheduledDeletionResponse struct {
+	Data ServerScheduledDeletionData `json:"data"`
+	Meta meta                        `json:"meta"`
+}
+
+type ServerScheduledDeletionData struct {
+	ID         string                            `json:"id"`
+	Type       string                            `json:"type"`
+	Attributes ServerScheduledDeletionAttributes `json:"attributes"`
+}
+
+type ServerScheduledDeletionAttributes struct {
+	ServerID            string    `json:"server_id"`
+	ScheduledDeletionAt Timestamp `json:"scheduled_deletion_at"`
 }
 
 type ServerProject struct {
-	ID   interface{} `json:"id"`
-	Name string      `json:"name"`
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Slug          string               `json:"slug"`
+	Description   string               `json:"description"`
+	BillingType   string               `json:"billing_type"`
+	BillingMethod string               `json:"billing_method"`
+	Environment   string               `json:"environment"`
+	Billing       ServerProjectBilling `json:"billing"`
+}
+
+// UnmarshalJSON accepts the project id as either a string or a number, as
+// older API responses return numeric ids
+func (p *ServerProject) UnmarshalJSON(b []byte) error {
+	type serverProject ServerProject
+	var project struct {
+		serverProject
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(b, &project); err != nil {
+		return err
+	}
+
+	*p = ServerProject(project.serverProject)
+	if len(project.ID) == 0 || string(project.ID) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(project.ID, &p.ID); err != nil {
+		var id json.Number
+		if err := json.Unmarshal(project.ID, &id); err != nil {
+			return err
+		}
+		p.ID = id.String()
+	}
+	return nil
+}
+
+type ServerProjectBilling struct {
+	SubscriptionID string `json:"subscription_id"`
+	Type           string `json:"type"`
+	Method         string `json:"method"`
 }
 
 type ServerRegion struct {
@@ -197,9 +343,10 @@ type ServerSite struct {
 }
 
 type ServerPlan struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	Billing string `json:"billing"`
 }
 
 type ServerOperatingSystem struct {
@@ -213,21 +360,47 @@ type ServerOperatingSystem struct {
 // Flatten latitude API data structures
 func NewFlatServer(sd ServerGetData) Server {
 	return Server{
-		sd.ID,
-		sd.Attributes.Hostname,
-		sd.Attributes.Label,
-		sd.Attributes.Role,
-		sd.Attributes.Status,
-		sd.Attributes.PrimaryIPv4,
-		sd.Attributes.IMPIStatus,
-		sd.Attributes.Locked,
-		sd.Attributes.CreatedAt,
-		sd.Attributes.Specs,
-		sd.Attributes.Project,
-		sd.Attributes.OperatingSystem,
-		sd.Attributes.Plan,
-		sd.Attributes.Region,
-		sd.Attributes.Tags,
+		ID:                  sd.ID,
+		Hostname:            sd.Attributes.Hostname,
+		Label:               sd.Attributes.Label,
+		Price:               sd.Attributes.Price,
+		Role:                sd.Attributes.Role,
+		Status:              sd.Attributes.Status,
+		PrimaryIPv4:         sd.Attributes.PrimaryIPv4,
+		IMPIStatus:          sd.Attributes.IMPIStatus,
+		Site:                sd.Attributes.Site,
+		InstanceType:        sd.Attributes.InstanceType,
+		Locked:              sd.Attributes.Locked,
+		CreatedAt:           sd.Attributes.CreatedAt,
+		ScheduledDeletionAt: sd.Attributes.ScheduledDeletionAt,
+		Specs:               sd.Attributes.Specs,
+		Project:             sd.Attributes.Project,
+		OperatingSystem:     sd.Attributes.OperatingSystem,
+		Plan:                sd.Attributes.Plan,
+		Region:              sd.Attributes.Region,
+		Team:                sd.Attributes.Team,
+		Tags:                sd.Attributes.Tags,
+		rawAttributes:       sd.RawAttributes,
+	}
+}
+
+// RawAttributes returns the JSON:API attributes of the server as returned by
+// the API, so that attributes the SDK doesn't model yet can still be decoded.
+// It is nil for servers that weren't built from an API response.
+func (s Server) RawAttributes() json.RawMessage {
+	return s.rawAttributes
+}
+
+// DeletionScheduled reports whether the server is pending deletion at the end of its billing period
+func (s Server) DeletionScheduled() bool {
+	return s.ScheduledDeletionAt != nil && !s.ScheduledDeletionAt.IsZero()
+}
+
+func NewFlatServerScheduledDeletion(sd ServerScheduledDeletionData) ServerScheduledDeletion {
+	return ServerScheduledDeletion{
+		ID:                  sd.ID,
+		ServerID:            sd.Attributes.ServerID,
+		ScheduledDeletionAt: sd.Attributes.ScheduledDeletionAt,
 	}
 }
 
@@ -239,23 +412,35 @@ func NewFlatServerList(sd []ServerGetData) []Server {
 	return res
 }
 
-func waitServerActive(s *ServerServiceOp, id string) (*Server, error) {
-	// 15 minutes = 180 * 15sec-retry
-	for i := 0; i < 180; i++ {
-		<-time.After(15 * time.Second)
-		s, _, err := s.Get(id, nil)
+func waitServerActive(ctx context.Context, s *ServerServiceOp, id string) (*Server, error) {
+	return waitServerStatus(ctx, s, id, ServerStatusOn)
+}
+
+func waitServerStatus(ctx context.Context, s *ServerServiceOp, id string, status ServerStatus) (*Server, error) {
+	timer := time.NewTimer(serverPollInterval)
+	defer timer.Stop()
+	for i := 0; i < serverPollRetries; i++ {
+		if i > 0 {
+			timer.Reset(serverPollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		server, _, err := s.Get(id, nil)
 		if err != nil {
 			return nil, err
 		}
-		if s.Status == "on" {
-			return s, nil
-		}
-		if s.Status == "failed" {
-			return nil, fmt.Errorf("device %s provisioning failed", id)
+		switch ServerStatus(server.Status) {
+		case status:
+			return server, nil
+		case ServerStatusFailed, ServerStatusFailedDeployment:
+			return nil, fmt.Errorf("device %s failed while waiting for status %s", id, status)
 		}
 	}
 
-	return nil, fmt.Errorf("device %s is still not active after timeout", id)
+	return nil, fmt.Errorf("device %s is still not %s after timeout", id, status)
 }
 
 // List returns servers on a project
@@ -296,17 +481,35 @@ func (s *ServerServiceOp) Get(serverID string, opts *GetOptions) (*Server, *Resp
 	return &flatServer, resp, err
 }
 
-// Create creates a new server
+// Create creates a new server and waits for it to be on. When a budget is set on the client, a server
+// that would exceed it is refused with a *BudgetExceededError.
 func (s *ServerServiceOp) Create(createRequest *ServerCreateRequest) (*Server, *Response, error) {
+	return s.CreateContext(context.Background(), createRequest)
+}
+
+// CreateContext is Create, returning the context error once ctx is done while
+// waiting for the server. The create request itself isn't interrupted, so the
+// server may exist even when an error is returned.
+func (s *ServerServiceOp) CreateContext(ctx context.Context, createRequest *ServerCreateRequest) (*Server, *Response, error) {
 	server := new(ServerGetResponse)
 
+	release := func(created bool) {}
+	if s.budget != nil && !createRequest.BudgetOverride {
+		var err error
+		if release, err = s.budget.reserve(createRequest); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	resp, err := s.client.DoRequest("POST", serverBasePath, createRequest, server)
+	// once created the server counts towards the current spend
+	release(err == nil)
 	if err != nil {
 		return nil, resp, err
 	}
 
 	flatServer := NewFlatServer(server.Data)
-	_, err = waitServerActive(s, flatServer.ID)
+	_, err = waitServerActive(ctx, s, flatServer.ID)
 	return &flatServer, resp, err
 }
 
@@ -359,3 +562,52 @@ func (s *ServerServiceOp) Unlock(serverID string) (*Server, *Response, error) {
 	return &flatServer, resp, err
 
 }
+
+// EnterRescueMode boots the server into rescue mode. The transition is
+// asynchronous, use WaitForStatus with ServerStatusRescueMode to block until it completes.
+func (s *ServerServiceOp) EnterRescueMode(serverID string) (*Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, "rescue_mode")
+
+	return s.client.DoRequest("POST", apiPath, nil, nil)
+}
+
+// ExitRescueMode boots the server back into its installed operating system. The transition is
+// asynchronous, use WaitForStatus with ServerStatusOn to block until it completes.
+func (s *ServerServiceOp) ExitRescueMode(serverID string) (*Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, "exit_rescue_mode")
+
+	return s.client.DoRequest("POST", apiPath, nil, nil)
+}
+
+// WaitForStatus polls the server until it reports the given status, fails, or times out
+func (s *ServerServiceOp) WaitForStatus(serverID string, status ServerStatus) (*Server, error) {
+	return waitServerStatus(context.Background(), s, serverID, status)
+}
+
+// WaitForStatusContext is WaitForStatus, also returning the context error
+// once ctx is done
+func (s *ServerServiceOp) WaitForStatusContext(ctx context.Context, serverID string, status ServerStatus) (*Server, error) {
+	return waitServerStatus(ctx, s, serverID, status)
+}
+
+// ScheduleDeletion schedules the server to be deleted at the end of its billing period.
+// Unlike Delete, the server keeps running until then and the deletion can be cancelled with UnscheduleDeletion.
+func (s *ServerServiceOp) ScheduleDeletion(serverID string) (*ServerScheduledDeletion, *Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, "schedule_deletion")
+	deletion := new(ServerScheduledDeletionResponse)
+
+	resp, err := s.client.DoRequest("POST", apiPath, nil, deletion)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	flatDeletion := NewFlatServerScheduledDeletion(deletion.Data)
+	return &flatDeletion, resp, err
+}
+
+// UnscheduleDeletion cancels a pending scheduled deletion of the server
+func (s *ServerServiceOp) UnscheduleDeletion(serverID string) (*Response, error) {
+	apiPath := path.Join(serverBasePath, serverID, "schedule_deletion")
+
+	return s.client.DoRequest("DELETE", apiPath, nil, nil)
+}
@@ -0,0 +1,191 @@
+package latitude
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBulkConcurrency = 5
+
+// hostnameVerbRegexp matches the integer verbs allowed in a hostname pattern
+var hostnameVerbRegexp = regexp.MustCompile(`%[-+ #0]*[0-9]*d`)
+
+// BulkCreateOptions controls how ServerService.BulkCreate runs
+type BulkCreateOptions struct {
+	// Concurrency is the maximum number of servers created at once.
+	// Defaults to 5.
+	Concurrency int
+
+	// RateLimit is the minimum interval between two create calls, shared by
+	// all workers. Zero means no limit.
+	RateLimit time.Duration
+
+	// Rollback deletes the servers that were created when more than
+	// MaxFailures requests fail
+	Rollback    bool
+	MaxFailures int
+}
+
+// BulkCreateResult is the outcome of a single create request of a bulk create
+type BulkCreateResult struct {
+	Index      int
+	Request    *ServerCreateRequest
+	Server     *Server
+	Response   *Response
+	Err        error
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	// RolledBack is set when the server was created but deleted again
+	// because too many other requests failed. RollbackErr is the error of
+	// the delete when the rollback failed and the server was left.
+	RolledBack  bool
+	RollbackErr error
+}
+
+// Duration returns how long the request took, including waiting for the
+// server to become active
+func (r BulkCreateResult) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// BulkCreateResults holds one result per request, in request order
+type BulkCreateResults []BulkCreateResult
+
+// Succeeded returns the results of the servers that were created and kept
+func (rs BulkCreateResults) Succeeded() BulkCreateResults {
+	var res BulkCreateResults
+	for _, r := range rs {
+		if r.Err == nil && !r.RolledBack {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// Failed returns the results of the requests that failed
+func (rs BulkCreateResults) Failed() BulkCreateResults {
+	var res BulkCreateResults
+	for _, r := range rs {
+		if r.Err != nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// BulkCreateError is returned by BulkCreate when at least one request failed.
+// On rollback, RolledBack lists the IDs of the servers that were deleted and
+// Left the IDs of those whose delete failed and need cleaning up by hand.
+type BulkCreateError struct {
+	Total      int
+	Failed     int
+	RolledBack []string
+	Left       []string
+}
+
+func (e *BulkCreateError) Error() string {
+	msg := fmt.Sprintf("%d of %d servers failed to be created", e.Failed, e.Total)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf(", %d created servers were rolled back", len(e.RolledBack))
+	}
+	if len(e.Left) > 0 {
+		msg += fmt.Sprintf(", %d could not be deleted: %s", len(e.Left), strings.Join(e.Left, ", "))
+	}
+	return msg
+}
+
+// NewBulkCreateRequests returns count copies of template, each with a hostname
+// built from hostnamePattern. The pattern is a fmt format with a single
+// integer verb, such as "web-%02d", and indices start at 1. A pattern
+// without a verb gets "-<index>" appended, any other use of % is an error.
+func NewBulkCreateRequests(template ServerCreateRequest, count int, hostnamePattern string) ([]ServerCreateRequest, error) {
+	verbs := len(hostnameVerbRegexp.FindAllString(hostnamePattern, -1))
+	if verbs > 1 || strings.Count(hostnamePattern, "%") != verbs {
+		return nil, fmt.Errorf("hostname pattern %q must have at most one integer verb such as %%d or %%02d", hostnamePattern)
+	}
+
+	requests := make([]ServerCreateRequest, count)
+	for i := range requests {
+		req := template
+		req.Data.Attributes.SSHKeys = append([]string(nil), template.Data.Attributes.SSHKeys...)
+		if verbs == 1 {
+			req.Data.Attributes.Hostname = fmt.Sprintf(hostnamePattern, i+1)
+		} else {
+			req.Data.Attributes.Hostname = fmt.Sprintf("%s-%d", hostnamePattern, i+1)
+		}
+		requests[i] = req
+	}
+	return requests, nil
+}
+
+// BulkCreate creates every requested server with a bounded pool of workers and
+// returns a result for each request, in request order. If any request fails
+// a *BulkCreateError is returned along with the results.
+func (s *ServerServiceOp) BulkCreate(requests []ServerCreateRequest, opts *BulkCreateOptions) (BulkCreateResults, error) {
+	if opts == nil {
+		opts = &BulkCreateOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	var throttle <-chan time.Time
+	if opts.RateLimit > 0 {
+		ticker := time.NewTicker(opts.RateLimit)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	results := make(BulkCreateResults, len(requests))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if throttle != nil {
+					<-throttle
+				}
+				r := BulkCreateResult{Index: i, Request: &requests[i], StartedAt: time.Now()}
+				r.Server, r.Response, r.Err = s.Create(&requests[i])
+				r.FinishedAt = time.Now()
+				results[i] = r
+			}
+		}()
+	}
+	for i := range requests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := len(results.Failed())
+	if failed == 0 {
+		return results, nil
+	}
+
+	bulkErr := &BulkCreateError{Total: len(requests), Failed: failed}
+	if opts.Rollback && failed > opts.MaxFailures {
+		for i, r := range results {
+			// servers that failed to provision still exist and are removed too
+			if r.Server == nil || r.Server.ID == "" {
+				continue
+			}
+			if _, err := s.Delete(r.Server.ID); err != nil {
+				// keep the server in the results so it can be cleaned up by hand
+				results[i].RollbackErr = err
+				bulkErr.Left = append(bulkErr.Left, r.Server.ID)
+				continue
+			}
+			results[i].RolledBack = true
+			bulkErr.RolledBack = append(bulkErr.RolledBack, r.Server.ID)
+		}
+	}
+	return results, bulkErr
+}
@@ -0,0 +1,131 @@
+package latitude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewBulkCreateRequests(t *testing.T) {
+	template := ServerCreateRequest{
+		Data: ServerCreateData{
+			Type:       testServerType,
+			Attributes: ServerCreateAttributes{Plan: "c2-small-x86", SSHKeys: []string{"ssh_1"}},
+		},
+	}
+
+	reqs, err := NewBulkCreateRequests(template, 3, "web-%02d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(reqs), 3, "Bulk requests length")
+	assertEqual(t, reqs[0].Data.Attributes.Hostname, "web-01", "First hostname")
+	assertEqual(t, reqs[2].Data.Attributes.Hostname, "web-03", "Last hostname")
+	assertEqual(t, reqs[1].Data.Attributes.Plan, "c2-small-x86", "Template plan")
+
+	reqs, err = NewBulkCreateRequests(template, 1, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, reqs[0].Data.Attributes.Hostname, "db-1", "Hostname without verb")
+
+	for _, pattern := range []string{"web-%s", "web-%d-%d", "web-%v", "web-100%", "web-%%d"} {
+		if _, err := NewBulkCreateRequests(template, 1, pattern); err == nil {
+			t.Errorf("expected an error for hostname pattern %q", pattern)
+		}
+	}
+}
+
+func TestServerBulkCreate(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	deleted := map[string]bool{}
+	failDelete := ""
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			var req ServerCreateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			hn := req.Data.Attributes.Hostname
+			if strings.HasSuffix(hn, "3") || strings.HasSuffix(hn, "4") {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"errors":[{"code":"out_of_stock","status":"422","title":"Out of stock"}]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"id":"sv_%s","type":"servers","attributes":{"hostname":%q}}}`, hn, hn)
+		case "GET":
+			fmt.Fprint(w, `{"data":{"id":"sv","type":"servers","attributes":{"status":"on"}}}`)
+		case "DELETE":
+			if r.URL.Path == failDelete {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			mu.Lock()
+			deleted[r.URL.Path] = true
+			mu.Unlock()
+		}
+	})
+
+	reqs, err := NewBulkCreateRequests(ServerCreateRequest{Data: ServerCreateData{Type: testServerType}}, 6, "web-%d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.Servers.BulkCreate(reqs, &BulkCreateOptions{Concurrency: 2, Rollback: true, MaxFailures: 2})
+	var bulkErr *BulkCreateError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected a BulkCreateError, got %v", err)
+	}
+	assertEqual(t, bulkErr.Failed, 2, "Failed count")
+	assertEqual(t, len(bulkErr.RolledBack), 0, "Rolled back under threshold")
+	assertEqual(t, len(results.Succeeded()), 4, "Succeeded count")
+	assertEqual(t, results[2].Err != nil, true, "Third request failed")
+	assertEqual(t, results[5].Server.Hostname, "web-6", "Results in request order")
+	if atomic.LoadInt32(&maxInFlight) > 2 {
+		t.Fatalf("expected at most 2 concurrent creates, got %d", maxInFlight)
+	}
+
+	results, err = c.Servers.BulkCreate(reqs, &BulkCreateOptions{Concurrency: 3, Rollback: true, MaxFailures: 1})
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected a BulkCreateError, got %v", err)
+	}
+	assertEqual(t, len(bulkErr.RolledBack), 4, "Rolled back over threshold")
+	assertEqual(t, len(bulkErr.Left), 0, "Servers left over threshold")
+	assertEqual(t, len(results.Succeeded()), 0, "Succeeded after rollback")
+	assertEqual(t, len(deleted), 4, "Deleted servers")
+	assertEqual(t, deleted["/servers/sv_web-1"], true, "First server deleted")
+
+	failDelete = "/servers/sv_web-2"
+	results, err = c.Servers.BulkCreate(reqs, &BulkCreateOptions{Concurrency: 3, Rollback: true, MaxFailures: 1})
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected a BulkCreateError, got %v", err)
+	}
+	assertEqual(t, len(bulkErr.RolledBack), 3, "Rolled back with a failed delete")
+	assertEqual(t, len(bulkErr.Left), 1, "Servers left")
+	assertEqual(t, bulkErr.Left[0], "sv_web-2", "Server left")
+	assertEqual(t, results[1].RolledBack, false, "Left server not rolled back")
+	assertEqual(t, results[1].RollbackErr != nil, true, "Left server rollback error")
+	assertEqual(t, len(results.Succeeded()), 1, "Succeeded with a failed delete")
+}
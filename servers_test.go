@@ -1,7 +1,13 @@
 package latitude
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 )
 
 const (
@@ -113,3 +119,134 @@ func TestAccServerBasic(t *testing.T) {
 		assertEqual(t, ser.Locked, false, "Server lock attribute")
 	})
 }
+
+func TestServerRescueMode(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	var calls []string
+	polls := 0
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusAccepted)
+		case "GET":
+			status := ServerStatusOn
+			if polls++; polls > 1 {
+				status = ServerStatusRescueMode
+			}
+			fmt.Fprintf(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"status":%q}}}`, status)
+		}
+	})
+
+	if _, err := c.Servers.EnterRescueMode("sv_1"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Servers.WaitForStatus("sv_1", ServerStatusRescueMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, s.Status, string(ServerStatusRescueMode), "Server status")
+
+	if _, err := c.Servers.ExitRescueMode("sv_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, calls[0], "POST /servers/sv_1/rescue_mode", "Enter rescue mode call")
+	assertEqual(t, calls[len(calls)-1], "POST /servers/sv_1/exit_rescue_mode", "Exit rescue mode call")
+}
+
+func TestServerWaitForStatusFailed(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"status":"failed_deployment"}}}`)
+	})
+
+	if _, err := c.Servers.WaitForStatus("sv_1", ServerStatusOn); err == nil {
+		t.Fatal("expected an error for a failed deployment")
+	}
+}
+
+func TestServerWaitForStatusContext(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1"}}}`)
+		case "GET":
+			// the server never comes up, the caller gives up after the first poll
+			cancel()
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"status":"deploying"}}}`)
+		}
+	})
+
+	s, _, err := c.Servers.CreateContext(ctx, &ServerCreateRequest{Data: ServerCreateData{Type: "servers", Attributes: ServerCreateAttributes{Hostname: "web-1"}}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	assertEqual(t, s.ID, "sv_1", "Created server")
+
+	if _, err := c.Servers.WaitForStatusContext(ctx, "sv_1", ServerStatusOn); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
+
+func TestServerScheduleDeletion(t *testing.T) {
+	var calls []string
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "POST":
+			fmt.Fprint(w, `{"data":{"id":"sd_1","type":"schedule_deletion","attributes":{"server_id":"sv_1","scheduled_deletion_at":"2026-11-01T00:00:00Z"}}}`)
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	sd, _, err := c.Servers.ScheduleDeletion("sv_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, sd.ServerID, "sv_1", "Scheduled deletion server")
+	assertEqual(t, sd.ScheduledDeletionAt.Equal(Timestamp{time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)}), true, "Scheduled deletion date")
+
+	if _, err := c.Servers.UnscheduleDeletion("sv_1"); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, calls[1], "DELETE /servers/sv_1/schedule_deletion", "Unschedule deletion call")
+}
+
+func TestNewFlatServerFullAttributes(t *testing.T) {
+	body := `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":"web-1","price":1349.0,"site":"SAO","instance_type":"bare_metal","ipmi_status":"Normal","created_at":"2024-07-24T15:36:28+00:00","scheduled_deletion_at":null,"team":{"id":"team_1","name":"Team","currency":{"code":"USD"}},"project":{"id":42,"name":"Project","billing":{"type":"Normal"}},"plan":{"slug":"c2-small-x86","billing":"yearly"},"rescue_hint":"unmodelled"}}}`
+
+	res := new(ServerGetResponse)
+	if err := json.Unmarshal([]byte(body), res); err != nil {
+		t.Fatal(err)
+	}
+	s := NewFlatServer(res.Data)
+
+	assertEqual(t, s.Price, 1349.0, "Server price")
+	assertEqual(t, s.Site, "SAO", "Server site")
+	assertEqual(t, s.InstanceType, "bare_metal", "Server instance type")
+	assertEqual(t, s.IMPIStatus, "Normal", "Server IPMI status")
+	assertEqual(t, s.Team.Currency.Code, "USD", "Server team currency")
+	assertEqual(t, s.Project.ID, "42", "Server project id")
+	assertEqual(t, s.Plan.Billing, "yearly", "Server plan billing")
+	assertEqual(t, s.CreatedAt.Equal(Timestamp{time.Date(2024, 7, 24, 15, 36, 28, 0, time.UTC)}), true, "Server created at")
+	assertEqual(t, s.DeletionScheduled(), false, "Server deletion scheduled")
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(s.RawAttributes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, raw["rescue_hint"], "unmodelled", "Server raw attributes")
+}
@@ -0,0 +1,377 @@
+package latitude
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	multiplierRegexp = regexp.MustCompile(`(?i)^\s*([0-9]+)\s*[x×]\s*(.+)$`)
+	speedRegexp      = regexp.MustCompile(`(?i)^\s*([0-9]*\.?[0-9]+)\s*([KMGT])(?:bps|bit/s|b/s|bit)?\s*$`)
+)
+
+// splitMultiplier splits a spec such as "2 x 960 GB" into its count and the
+// remaining value, a spec without a multiplier has a count of 1
+func splitMultiplier(spec string) (int, string) {
+	m := multiplierRegexp.FindStringSubmatch(spec)
+	if m == nil {
+		return 1, strings.TrimSpace(spec)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 1, strings.TrimSpace(spec)
+	}
+	return n, strings.TrimSpace(m[2])
+}
+
+// parseSpeedGbps parses a link speed such as "10 Gbps", "10Gbps" or
+// "1 Gbit/s" into gigabits per second
+func parseSpeedGbps(speed string) (float64, error) {
+	m := speedRegexp.FindStringSubmatch(speed)
+	if m == nil {
+		return 0, fmt.Errorf("invalid speed %q", speed)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed %q: %w", speed, err)
+	}
+	switch strings.ToUpper(m[2]) {
+	case "K":
+		return n / 1e6, nil
+	case "M":
+		return n / 1e3, nil
+	case "T":
+		return n * 1e3, nil
+	}
+	return n, nil
+}
+
+// TotalCores returns the number of cores across all CPUs
+func (s PlanSpecs) TotalCores() int {
+	count := s.CPU.Count
+	if count == 0 {
+		count = 1
+	}
+	return s.CPU.Cores * count
+}
+
+// MemoryGB returns the total memory in GB
+func (s PlanSpecs) MemoryGB() (float64, error) {
+	return parseSizeGB(s.Memory.Total)
+}
+
+// DriveCapacityGB returns the raw capacity of the drives of the given type,
+// such as "NVME" or "SSD", or of every drive when driveType is empty
+func (s PlanSpecs) DriveCapacityGB(driveType string) (float64, error) {
+	total := 0.0
+	for _, d := range s.Drives {
+		if driveType != "" && !strings.EqualFold(d.Type, driveType) {
+			continue
+		}
+		n, size := splitMultiplier(d.Size)
+		gb, err := parseSizeGB(size)
+		if err != nil {
+			return 0, err
+		}
+		count := d.Count
+		if count == 0 {
+			count = 1
+		}
+		total += gb * float64(n*count)
+	}
+	return total, nil
+}
+
+// NICSpeedGbps returns the speed of the fastest network port
+func (s PlanSpecs) NICSpeedGbps() (float64, error) {
+	fastest := 0.0
+	for _, nic := range s.NICs {
+		_, speed := splitMultiplier(nic.Type)
+		gbps, err := parseSpeedGbps(speed)
+		if err != nil {
+			return 0, err
+		}
+		if gbps > fastest {
+			fastest = gbps
+		}
+	}
+	return fastest, nil
+}
+
+// HasGPU reports whether the plan comes with at least one GPU
+func (s PlanSpecs) HasGPU() bool {
+	return s.GPU.Count > 0
+}
+
+// bytesPerGB converts the GB sizes of the API to bytes. Memory and disks are
+// both read as decimal gigabytes, 1 GB being 10^9 bytes.
+const bytesPerGB = 1e9
+
+var (
+	cpuClockRegexp   = regexp.MustCompile(`(?i)@?\s*([0-9]*\.?[0-9]+)\s*GHz`)
+	cpuCoresRegexp   = regexp.MustCompile(`(?i)([0-9]+)\s*cores?`)
+	cpuThreadsRegexp = regexp.MustCompile(`(?i)([0-9]+)\s*threads?`)
+	diskRegexp       = regexp.MustCompile(`(?i)^([0-9]*\.?[0-9]+\s*[KMGTP]i?B?)\s*(.*)$`)
+)
+
+// CPUSpec is a parsed CPU description
+type CPUSpec struct {
+	Model    string
+	Sockets  int
+	Cores    int
+	Threads  int
+	ClockGHz float64
+}
+
+// DiskSpec is a group of identical drives
+type DiskSpec struct {
+	Count     int
+	SizeBytes int64
+	Type      string
+}
+
+// NICSpec is a group of identical network ports
+type NICSpec struct {
+	Count     int
+	SpeedGbps float64
+}
+
+// GPUSpec is a group of identical GPUs
+type GPUSpec struct {
+	Count int
+	Model string
+}
+
+// HardwareSpecs is the parsed hardware of a server or plan. Cores and
+// Threads are totals across sockets, and zero when unknown. Memory and disk
+// sizes are in bytes, from decimal gigabytes (see bytesPerGB).
+type HardwareSpecs struct {
+	CPU         CPUSpec
+	MemoryBytes int64
+	Disks       []DiskSpec
+	NICs        []NICSpec
+	GPU         GPUSpec
+}
+
+// DiskBytes returns the raw capacity of the drives of the given type, or of
+// every drive when diskType is empty
+func (h HardwareSpecs) DiskBytes(diskType string) int64 {
+	var total int64
+	for _, d := range h.Disks {
+		if diskType == "" || strings.EqualFold(d.Type, diskType) {
+			total += d.SizeBytes * int64(d.Count)
+		}
+	}
+	return total
+}
+
+// NICCount returns the number of network ports
+func (h HardwareSpecs) NICCount() int {
+	n := 0
+	for _, nic := range h.NICs {
+		n += nic.Count
+	}
+	return n
+}
+
+// Parse parses the plan specs into HardwareSpecs
+func (s PlanSpecs) Parse() (HardwareSpecs, error) {
+	h := HardwareSpecs{
+		CPU: CPUSpec{
+			Model:    s.CPU.Type,
+			Sockets:  s.CPU.Count,
+			Cores:    s.TotalCores(),
+			ClockGHz: s.CPU.Clock,
+		},
+		GPU: GPUSpec{Count: s.GPU.Count, Model: s.GPU.Type},
+	}
+	if h.CPU.Sockets == 0 {
+		h.CPU.Sockets = 1
+	}
+
+	if s.Memory.Total != "" {
+		gb, err := s.MemoryGB()
+		if err != nil {
+			return h, fmt.Errorf("memory: %w", err)
+		}
+		h.MemoryBytes = int64(gb * bytesPerGB)
+	}
+
+	for _, d := range s.Drives {
+		n, size := splitMultiplier(d.Size)
+		gb, err := parseSizeGB(size)
+		if err != nil {
+			return h, fmt.Errorf("drives: %w", err)
+		}
+		count := d.Count
+		if count == 0 {
+			count = 1
+		}
+		h.Disks = append(h.Disks, DiskSpec{Count: n * count, SizeBytes: int64(gb * bytesPerGB), Type: strings.ToUpper(d.Type)})
+	}
+
+	for _, nic := range s.NICs {
+		n, speed := splitMultiplier(nic.Type)
+		gbps, err := parseSpeedGbps(speed)
+		if err != nil {
+			return h, fmt.Errorf("nics: %w", err)
+		}
+		count := nic.Count
+		if count == 0 {
+			count = 1
+		}
+		h.NICs = append(h.NICs, NICSpec{Count: n * count, SpeedGbps: gbps})
+	}
+
+	return h, nil
+}
+
+// Parse parses the free-form server specs, such as
+// "Xeon E-2286G CPU @ 4.00GHz (6 cores)", "2 x 480 GB NVME" or
+// "2 X 1 Gbit/s", into HardwareSpecs. Several disks or NICs can be listed
+// separated by commas or "+".
+func (s ServerSpecs) Parse() (HardwareSpecs, error) {
+	h := HardwareSpecs{}
+
+	if s.CPU != "" {
+		sockets, model := splitMultiplier(s.CPU)
+		h.CPU.Sockets = sockets
+		h.CPU.Model = strings.TrimSpace(strings.Split(model, "@")[0])
+		if m := cpuClockRegexp.FindStringSubmatch(model); m != nil {
+			h.CPU.ClockGHz, _ = strconv.ParseFloat(m[1], 64)
+		}
+		if m := cpuCoresRegexp.FindStringSubmatch(model); m != nil {
+			cores, _ := strconv.Atoi(m[1])
+			h.CPU.Cores = cores * sockets
+		}
+		if m := cpuThreadsRegexp.FindStringSubmatch(model); m != nil {
+			threads, _ := strconv.Atoi(m[1])
+			h.CPU.Threads = threads * sockets
+		}
+	}
+
+	if s.RAM != "" {
+		gb, err := parseSizeGB(s.RAM)
+		if err != nil {
+			return h, fmt.Errorf("ram: %w", err)
+		}
+		h.MemoryBytes = int64(gb * bytesPerGB)
+	}
+
+	for _, part := range splitSpecList(s.Disk) {
+		n, disk := splitMultiplier(part)
+		m := diskRegexp.FindStringSubmatch(disk)
+		if m == nil {
+			return h, fmt.Errorf("disk: invalid disk %q", part)
+		}
+		gb, err := parseSizeGB(m[1])
+		if err != nil {
+			return h, fmt.Errorf("disk: %w", err)
+		}
+		h.Disks = append(h.Disks, DiskSpec{Count: n, SizeBytes: int64(gb * bytesPerGB), Type: strings.ToUpper(strings.TrimSpace(m[2]))})
+	}
+
+	for _, part := range splitSpecList(s.NIC) {
+		n, speed := splitMultiplier(part)
+		gbps, err := parseSpeedGbps(speed)
+		if err != nil {
+			return h, fmt.Errorf("nic: %w", err)
+		}
+		h.NICs = append(h.NICs, NICSpec{Count: n, SpeedGbps: gbps})
+	}
+
+	if s.GPU != "" {
+		n, model := splitMultiplier(s.GPU)
+		h.GPU = GPUSpec{Count: n, Model: model}
+	}
+
+	return h, nil
+}
+
+func splitSpecList(spec string) []string {
+	var parts []string
+	for _, p := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '+' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// SpecMismatch is a difference between the hardware of a server and the
+// hardware of its plan
+type SpecMismatch struct {
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (m SpecMismatch) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", m.Field, m.Expected, m.Actual)
+}
+
+// memoryTolerance is the share of memory a server may report below its plan,
+// as reserved memory is usually not reported by the hardware
+const memoryTolerance = 0.05
+
+// CompareSpecs returns the differences between deployed hardware and the
+// expected hardware of a plan. Values unknown on either side are not compared.
+func CompareSpecs(actual, expected HardwareSpecs) []SpecMismatch {
+	var mismatches []SpecMismatch
+	add := func(field string, want, got interface{}) {
+		mismatches = append(mismatches, SpecMismatch{Field: field, Expected: fmt.Sprint(want), Actual: fmt.Sprint(got)})
+	}
+
+	if actual.CPU.Cores > 0 && expected.CPU.Cores > 0 && actual.CPU.Cores != expected.CPU.Cores {
+		add("cpu.cores", expected.CPU.Cores, actual.CPU.Cores)
+	}
+	if actual.MemoryBytes > 0 && expected.MemoryBytes > 0 {
+		low := float64(expected.MemoryBytes) * (1 - memoryTolerance)
+		if float64(actual.MemoryBytes) < low || actual.MemoryBytes > expected.MemoryBytes*2 {
+			add("memory", formatGB(expected.MemoryBytes), formatGB(actual.MemoryBytes))
+		}
+	}
+	if len(actual.Disks) > 0 && len(expected.Disks) > 0 {
+		types := map[string]bool{}
+		for _, d := range expected.Disks {
+			types[d.Type] = true
+		}
+		for _, d := range actual.Disks {
+			types[d.Type] = true
+		}
+		for t := range types {
+			if got, want := actual.DiskBytes(t), expected.DiskBytes(t); got != want {
+				add("disk."+strings.ToLower(t), formatGB(want), formatGB(got))
+			}
+		}
+	}
+	if len(actual.NICs) > 0 && len(expected.NICs) > 0 && actual.NICCount() != expected.NICCount() {
+		add("nic.count", expected.NICCount(), actual.NICCount())
+	}
+	if actual.GPU.Count > 0 && expected.GPU.Count > 0 && actual.GPU.Count != expected.GPU.Count {
+		add("gpu.count", expected.GPU.Count, actual.GPU.Count)
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Field < mismatches[j].Field })
+	return mismatches
+}
+
+func formatGB(bytes int64) string {
+	return strconv.FormatFloat(float64(bytes)/bytesPerGB, 'f', -1, 64) + " GB"
+}
+
+// CheckSpecs compares the hardware of the server with the hardware of its plan
+func (s Server) CheckSpecs(plan Plan) ([]SpecMismatch, error) {
+	actual, err := s.Specs.Parse()
+	if err != nil {
+		return nil, err
+	}
+	expected, err := plan.Specs.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return CompareSpecs(actual, expected), nil
+}
@@ -0,0 +1,76 @@
+package latitude
+
+import (
+	"testing"
+)
+
+func TestServerSpecsParse(t *testing.T) {
+	specs := ServerSpecs{
+		CPU:  "2 x Xeon Gold 6248 CPU @ 2.50GHz (20 cores, 40 threads)",
+		Disk: "2 x 480 GB NVME, 1.9 TB SSD",
+		RAM:  "384 GB",
+		NIC:  "2 X 10 Gbit/s",
+		GPU:  "8 x NVIDIA H100",
+	}
+	h, err := specs.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, h.CPU.Model, "Xeon Gold 6248 CPU", "CPU model")
+	assertEqual(t, h.CPU.Sockets, 2, "CPU sockets")
+	assertEqual(t, h.CPU.Cores, 40, "CPU cores")
+	assertEqual(t, h.CPU.Threads, 80, "CPU threads")
+	assertEqual(t, h.CPU.ClockGHz, 2.5, "CPU clock")
+	assertEqual(t, h.MemoryBytes, int64(384e9), "Memory")
+	assertEqual(t, len(h.Disks), 2, "Disk groups")
+	assertEqual(t, h.DiskBytes("nvme"), int64(960e9), "NVMe capacity")
+	assertEqual(t, h.DiskBytes("SSD"), int64(1900e9), "SSD capacity")
+	assertEqual(t, h.NICCount(), 2, "NIC count")
+	assertEqual(t, h.NICs[0].SpeedGbps, 10.0, "NIC speed")
+	assertEqual(t, h.GPU, GPUSpec{Count: 8, Model: "NVIDIA H100"}, "GPU")
+
+	if _, err := (ServerSpecs{Disk: "lots"}).Parse(); err == nil {
+		t.Fatal("Expected an error for an invalid disk")
+	}
+}
+
+func TestCheckSpecs(t *testing.T) {
+	plan := Plan{Specs: PlanSpecs{
+		CPU:    PlanCPU{Type: "Xeon E-2286G", Clock: 4, Cores: 6, Count: 1},
+		Memory: PlanMemory{Total: "64"},
+		Drives: []PlanDrive{{Count: 1, Size: "1TB", Type: "SSD"}},
+		NICs:   []PlanNIC{{Count: 1, Type: "2 x 1Gbps"}},
+	}}
+	server := Server{Specs: ServerSpecs{
+		CPU:  "Xeon E-2286G CPU @ 4.00GHz (6 cores)",
+		Disk: "1 TB SSD",
+		RAM:  "62 GB",
+		NIC:  "2 X 1 Gbit/s",
+	}}
+
+	mismatches, err := server.CheckSpecs(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(mismatches), 0, "Mismatches")
+
+	server.Specs.RAM = "32 GB"
+	server.Specs.Disk = "480 GB SSD"
+	mismatches, err = server.CheckSpecs(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(mismatches), 2, "Mismatches")
+	assertEqual(t, mismatches[0], SpecMismatch{Field: "disk.ssd", Expected: "1000 GB", Actual: "480 GB"}, "Disk mismatch")
+	assertEqual(t, mismatches[1].String(), "memory: expected 64 GB, got 32 GB", "Memory mismatch")
+
+	// the server specs don't report GPUs, the count isn't compared
+	plan.Specs.GPU = PlanGPU{Count: 8, Type: "NVIDIA H100"}
+	server.Specs.RAM, server.Specs.Disk = "62 GB", "1 TB SSD"
+	mismatches, err = server.CheckSpecs(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(mismatches), 0, "Mismatches without a server GPU")
+}
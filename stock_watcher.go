@@ -0,0 +1,253 @@
+package latitude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStockWatchInterval = time.Minute
+
+// StockWatchTarget is a plan and site pair to watch. An empty Site watches
+// every site of the plan.
+type StockWatchTarget struct {
+	Plan string
+	Site string
+}
+
+// StockState is the stock of a plan in a site
+type StockState struct {
+	InStock    bool
+	StockLevel StockLevel
+}
+
+// StockEvent reports a stock change of a plan in a site
+type StockEvent struct {
+	Plan     string
+	Site     string
+	Previous StockState
+	Current  StockState
+	At       time.Time
+}
+
+// QueuedCreateResult is the outcome of a create queued on a StockWatcher
+type QueuedCreateResult struct {
+	Server   *Server
+	Response *Response
+	Err      error
+}
+
+type queuedCreate struct {
+	request *ServerCreateRequest
+	result  chan QueuedCreateResult
+}
+
+// StockWatcher polls the plans and reports stock changes of the watched plan
+// and site pairs. Events are only emitted on transitions, the first poll
+// records the initial state without emitting anything.
+type StockWatcher struct {
+	client *Client
+
+	// Interval between polls, defaults to one minute
+	Interval time.Duration
+
+	// Targets to watch, every plan and site when empty
+	Targets []StockWatchTarget
+
+	// OnEvent and OnError, if set, are called from the polling goroutine
+	OnEvent func(StockEvent)
+	OnError func(error)
+
+	mu     sync.Mutex
+	states map[StockWatchTarget]StockState
+	queue  []queuedCreate
+}
+
+// NewStockWatcher returns a StockWatcher polling on the given interval
+func NewStockWatcher(c *Client, interval time.Duration, targets ...StockWatchTarget) *StockWatcher {
+	return &StockWatcher{client: c, Interval: interval, Targets: targets}
+}
+
+// QueueCreate creates the server as soon as its plan is in stock in its site.
+// The plan and site must be among the watched targets, others are refused.
+// The result is sent on the returned channel once the create call returns,
+// and a create refused for lack of stock is queued again, as is one whose
+// plan or site stops being listed. When the context of Run or Watch is done,
+// the creates still queued or running get its error.
+func (w *StockWatcher) QueueCreate(req *ServerCreateRequest) (<-chan QueuedCreateResult, error) {
+	attrs := req.Data.Attributes
+	if !w.watches(attrs.Plan, attrs.Site) {
+		return nil, fmt.Errorf("plan %s in site %s is not watched", attrs.Plan, attrs.Site)
+	}
+	result := make(chan QueuedCreateResult, 1)
+	w.mu.Lock()
+	w.queue = append(w.queue, queuedCreate{request: req, result: result})
+	w.mu.Unlock()
+	return result, nil
+}
+
+// Watch runs the watcher in a new goroutine and returns its events. OnEvent,
+// if set, is still called. The channel is closed when ctx is done.
+func (w *StockWatcher) Watch(ctx context.Context) <-chan StockEvent {
+	events := make(chan StockEvent)
+	go func() {
+		defer close(events)
+		_ = w.run(ctx, func(e StockEvent) {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events
+}
+
+// Run polls until ctx is done and returns its error
+func (w *StockWatcher) Run(ctx context.Context) error {
+	return w.run(ctx, nil)
+}
+
+// run polls until ctx is done, passing every event to OnEvent and emit
+func (w *StockWatcher) run(ctx context.Context, emit func(StockEvent)) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultStockWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx, emit); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			w.cancelQueue(ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *StockWatcher) watches(plan, site string) bool {
+	if len(w.Targets) == 0 {
+		return true
+	}
+	for _, t := range w.Targets {
+		if t.Plan == plan && (t.Site == "" || strings.EqualFold(t.Site, site)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *StockWatcher) poll(ctx context.Context, emit func(StockEvent)) error {
+	plans, _, err := w.client.Plans.List(nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	current := map[StockWatchTarget]StockState{}
+	for _, c := range RankPlacements(plans, PlacementRequest{IncludeOutOfStock: true}) {
+		if !w.watches(c.Plan, c.Site) {
+			continue
+		}
+		key := StockWatchTarget{Plan: c.Plan, Site: strings.ToUpper(c.Site)}
+		current[key] = StockState{InStock: c.InStock, StockLevel: c.StockLevel}
+	}
+
+	w.mu.Lock()
+	first := w.states == nil
+	previous := w.states
+	w.states = current
+	w.mu.Unlock()
+
+	if !first {
+		for key, state := range current {
+			prev, seen := previous[key]
+			if seen && prev == state {
+				continue
+			}
+			w.emit(emit, StockEvent{Plan: key.Plan, Site: key.Site, Previous: prev, Current: state, At: now})
+		}
+		// a plan or site no longer listed can't be deployed, report it out of stock
+		for key, prev := range previous {
+			if _, listed := current[key]; !listed && prev != (StockState{}) {
+				w.emit(emit, StockEvent{Plan: key.Plan, Site: key.Site, Previous: prev, At: now})
+			}
+		}
+	}
+
+	w.runQueue(ctx, current)
+	return nil
+}
+
+// emit passes the event to OnEvent and emit
+func (w *StockWatcher) emit(emit func(StockEvent), e StockEvent) {
+	if w.OnEvent != nil {
+		w.OnEvent(e)
+	}
+	if emit != nil {
+		emit(e)
+	}
+}
+
+// runQueue starts the queued creates whose plan is in stock in their site.
+// A create still running when ctx is done reports its error right away and
+// stops waiting for the server, but the server may still be created.
+func (w *StockWatcher) runQueue(ctx context.Context, current map[StockWatchTarget]StockState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pending := w.queue[:0]
+	for _, q := range w.queue {
+		attrs := q.request.Data.Attributes
+		state := current[StockWatchTarget{Plan: attrs.Plan, Site: strings.ToUpper(attrs.Site)}]
+		if !state.InStock {
+			pending = append(pending, q)
+			continue
+		}
+		go func(q queuedCreate) {
+			done := make(chan QueuedCreateResult, 1)
+			go func() {
+				server, resp, err := w.client.Servers.CreateContext(ctx, q.request)
+				done <- QueuedCreateResult{Server: server, Response: resp, Err: err}
+			}()
+
+			var res QueuedCreateResult
+			select {
+			case res = <-done:
+			case <-ctx.Done():
+				q.result <- QueuedCreateResult{Err: ctx.Err()}
+				return
+			}
+			if isOutOfStock(res.Err) {
+				// checked under mu so cancelQueue can't miss the requeued create
+				w.mu.Lock()
+				requeue := ctx.Err() == nil
+				if requeue {
+					w.queue = append(w.queue, q)
+				}
+				w.mu.Unlock()
+				if requeue {
+					return
+				}
+			}
+			q.result <- res
+		}(q)
+	}
+	w.queue = pending
+}
+
+// cancelQueue fails the creates still waiting for stock with err
+func (w *StockWatcher) cancelQueue(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, q := range w.queue {
+		q.result <- QueuedCreateResult{Err: err}
+	}
+	w.queue = nil
+}
@@ -0,0 +1,131 @@
+package latitude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStockWatcher(t *testing.T) {
+	interval := serverPollInterval
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = interval }()
+
+	// SAO flips in stock on the third poll, DAL never changes
+	var polls int32
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /plans":
+			inStock := `"DAL"`
+			if atomic.AddInt32(&polls, 1) >= 3 {
+				inStock = `"DAL","SAO"`
+			}
+			fmt.Fprintf(w, `{"data":[{"id":"plan_1","type":"plans","attributes":{"slug":"g3-h100-small","specs":{"memory":{"total":192}},"regions":[{"name":"Brazil","locations":{"available":["SAO"],"in_stock":[%[1]s]}},{"name":"United States","locations":{"available":["DAL"],"in_stock":[%[1]s]}}]}}]}`, inStock)
+		case "POST /servers":
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"hostname":"gpu-1","site":"SAO"}}}`)
+		case "GET /servers/sv_1":
+			fmt.Fprint(w, `{"data":{"id":"sv_1","type":"servers","attributes":{"status":"on"}}}`)
+		}
+	})
+
+	w := NewStockWatcher(c, time.Millisecond, StockWatchTarget{Plan: "g3-h100-small"})
+	queued, err := w.QueueCreate(&ServerCreateRequest{Data: ServerCreateData{Attributes: ServerCreateAttributes{Plan: "g3-h100-small", Site: "sao", Hostname: "gpu-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var onEvents int32
+	w.OnEvent = func(StockEvent) { atomic.AddInt32(&onEvents, 1) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := w.Watch(ctx)
+
+	e := <-events
+	assertEqual(t, e.Site, "SAO", "Event site")
+	assertEqual(t, e.Previous.InStock, false, "Previous stock")
+	assertEqual(t, e.Current.InStock, true, "Current stock")
+
+	select {
+	case res := <-queued:
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		assertEqual(t, res.Server.ID, "sv_1", "Queued server")
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued create didn't run")
+	}
+
+	// no further transitions, the channel closes on cancel without duplicates
+	cancel()
+	for e := range events {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	assertEqual(t, atomic.LoadInt32(&onEvents), int32(1), "OnEvent calls")
+}
+
+func TestStockWatcherQueue(t *testing.T) {
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"id":"plan_1","type":"plans","attributes":{"slug":"g3-h100-small","regions":[{"name":"Brazil","locations":{"available":["SAO"],"in_stock":[]}}]}}]}`)
+	})
+
+	w := NewStockWatcher(c, time.Millisecond, StockWatchTarget{Plan: "g3-h100-small", Site: "SAO"})
+	if _, err := w.QueueCreate(&ServerCreateRequest{Data: ServerCreateData{Attributes: ServerCreateAttributes{Plan: "g3-h100-small", Site: "DAL"}}}); err == nil {
+		t.Fatal("expected an error queueing a create for a site that isn't watched")
+	}
+
+	queued, err := w.QueueCreate(&ServerCreateRequest{Data: ServerCreateData{Attributes: ServerCreateAttributes{Plan: "g3-h100-small", Site: "SAO"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	<-done
+
+	select {
+	case res := <-queued:
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("expected the context error, got %v", res.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued create wasn't cancelled")
+	}
+}
+
+func TestStockWatcherDelisted(t *testing.T) {
+	// SAO is in stock on the first poll and no longer listed afterwards
+	var polls int32
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		regions := `{"name":"United States","locations":{"available":["DAL"],"in_stock":[]}}`
+		if atomic.AddInt32(&polls, 1) == 1 {
+			regions += `,{"name":"Brazil","locations":{"available":["SAO"],"in_stock":["SAO"]}}`
+		}
+		fmt.Fprintf(w, `{"data":[{"id":"plan_1","type":"plans","attributes":{"slug":"g3-h100-small","regions":[%s]}}]}`, regions)
+	})
+
+	w := NewStockWatcher(c, time.Millisecond, StockWatchTarget{Plan: "g3-h100-small"})
+	ctx, cancel := context.WithCancel(context.Background())
+	events := w.Watch(ctx)
+
+	select {
+	case e := <-events:
+		assertEqual(t, e.Site, "SAO", "Event site")
+		assertEqual(t, e.Previous.InStock, true, "Previous stock")
+		assertEqual(t, e.Current.InStock, false, "Current stock")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the delisted site")
+	}
+
+	// the delisted site is only reported once
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	for e := range events {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
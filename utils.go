@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 var timestampType = reflect.TypeOf(Timestamp{})
@@ -33,6 +37,16 @@ func contains(a []string, x string) bool {
 	return false
 }
 
+// containsFold tells whether a contains x, ignoring case.
+func containsFold(a []string, x string) bool {
+	for _, n := range a {
+		if strings.EqualFold(n, x) {
+			return true
+		}
+	}
+	return false
+}
+
 func stringifyValue(w io.Writer, val reflect.Value) error {
 	if val.Kind() == reflect.Ptr && val.IsNil() {
 		_, err := w.Write([]byte("<nil>"))
@@ -126,6 +140,24 @@ func stringifyValue(w io.Writer, val reflect.Value) error {
 	return nil
 }
 
+// writeFileAtomic writes b to path through a temporary file in the same
+// directory, so a concurrent reader never sees a partial write
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // validate UUID
 func ValidateUUID(uuid string) error {
 	r := regexp.MustCompile("^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$")
@@ -134,3 +166,32 @@ func ValidateUUID(uuid string) error {
 	}
 	return nil
 }
+
+var sizeRegexp = regexp.MustCompile(`(?i)^\s*([0-9]*\.?[0-9]+)\s*([KMGTP]i?B?)?\s*$`)
+
+// parseSizeGB parses a human readable size such as "480GB", "1.9 TB" or "64"
+// into gigabytes. Units are decimal, as used by drive vendors, and a bare
+// number is taken to be in GB.
+func parseSizeGB(size string) (float64, error) {
+	m := sizeRegexp.FindStringSubmatch(size)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+	switch strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(m[2]), "B"), "I")) {
+	case "K":
+		return n / 1e6, nil
+	case "M":
+		return n / 1e3, nil
+	case "", "G":
+		return n, nil
+	case "T":
+		return n * 1e3, nil
+	case "P":
+		return n * 1e6, nil
+	}
+	return 0, fmt.Errorf("invalid size unit in %q", size)
+}
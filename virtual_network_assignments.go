@@ -1,8 +1,7 @@
 package latitude
 
 import (
-	"errors"
-	"net/http"
+	"fmt"
 	"path"
 )
 
@@ -10,7 +9,8 @@ const vlanAssignmentBasePath = "/virtual_networks/assignments"
 
 type VlanAssignmentService interface {
 	List(listOpt *ListOptions) ([]VlanAssignment, *Response, error)
-	Get(VlanAssignmentID string) (*VlanAssignment, *Response, error)
+	ListFiltered(filter VlanAssignmentFilter, listOpt *ListOptions) ([]VlanAssignment, *Response, error)
+	Get(VlanAssignmentID string, filter *VlanAssignmentFilter) (*VlanAssignment, *Response, error)
 	Assign(assignRequest *VlanAssignRequest) (*VlanAssignment, *Response, error)
 	Delete(VlanAssignmentID string) (*Response, error)
 }
@@ -19,6 +19,36 @@ type VlanAssignmentServiceOp struct {
 	client requestDoer
 }
 
+// VlanAssignmentNotFoundError is returned by VlanAssignmentService.Get when
+// no assignment has the requested ID. Err is the underlying API error, if
+// any.
+type VlanAssignmentNotFoundError struct {
+	ID  string
+	Err error
+}
+
+func (e *VlanAssignmentNotFoundError) Error() string {
+	return fmt.Sprintf("virtual network assignment %s not found", e.ID)
+}
+
+func (e *VlanAssignmentNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// VlanAssignmentFilter selects assignments by virtual network, server and
+// status. Empty fields don't constrain the results.
+type VlanAssignmentFilter struct {
+	VirtualNetworkID string
+	ServerID         string
+	Status           string
+}
+
+func (f VlanAssignmentFilter) matches(va VlanAssignment) bool {
+	return (f.VirtualNetworkID == "" || va.VirtualNetworkID == f.VirtualNetworkID) &&
+		(f.ServerID == "" || va.ServerID == f.ServerID) &&
+		(f.Status == "" || va.Status == f.Status)
+}
+
 type VlanAssignmentData struct {
 	ID         string                   `json:"id"`
 	Type       string                   `json:"type"`
@@ -151,24 +181,48 @@ func (vn *VlanAssignmentServiceOp) List(opts *ListOptions) (vlanAssignments []Vl
 	}
 }
 
-func (s *VlanAssignmentServiceOp) Get(vlanAssignmentID string) (*VlanAssignment, *Response, error) {
-	vlans, resp, err := s.List(nil)
+// ListFiltered returns the assignments matching the filter. The virtual
+// network and server are filtered by the API, the status locally.
+func (s *VlanAssignmentServiceOp) ListFiltered(filter VlanAssignmentFilter, opts *ListOptions) ([]VlanAssignment, *Response, error) {
+	if filter.VirtualNetworkID != "" {
+		opts = opts.Filter("virtual_network_id", filter.VirtualNetworkID)
+	}
+	if filter.ServerID != "" {
+		opts = opts.Filter("server", filter.ServerID)
+	}
+	vlanAssignments, resp, err := s.List(opts)
 	if err != nil {
 		return nil, resp, err
 	}
 
-	for _, vlan := range vlans {
-		if vlan.ID == vlanAssignmentID {
-			return &vlan, resp, nil
+	var res []VlanAssignment
+	for _, va := range vlanAssignments {
+		if filter.matches(va) {
+			res = append(res, va)
 		}
 	}
+	return res, resp, nil
+}
 
-	resp.Status = "404 Not Found"
-	resp.StatusCode = http.StatusNotFound
-
-	notFoundErr := errors.New("ERROR\nStatus: 404\nSpecified Record Not Found")
-
-	return nil, resp, notFoundErr
+// Get returns an assignment by id, or a *VlanAssignmentNotFoundError when it
+// doesn't exist. The API has no endpoint for a single assignment, so Get
+// searches the assignment list: with a nil filter, a bare ID means listing
+// every assignment of the team. Setting the virtual network or server of the
+// assignment in filter narrows the listing on the API side.
+func (s *VlanAssignmentServiceOp) Get(vlanAssignmentID string, filter *VlanAssignmentFilter) (*VlanAssignment, *Response, error) {
+	if filter == nil {
+		filter = &VlanAssignmentFilter{}
+	}
+	vlanAssignments, resp, err := s.ListFiltered(*filter, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+	for _, va := range vlanAssignments {
+		if va.ID == vlanAssignmentID {
+			return &va, resp, nil
+		}
+	}
+	return nil, resp, &VlanAssignmentNotFoundError{ID: vlanAssignmentID}
 }
 
 func (s *VlanAssignmentServiceOp) Assign(assignRequest *VlanAssignRequest) (*VlanAssignment, *Response, error) {
@@ -183,6 +237,8 @@ func (s *VlanAssignmentServiceOp) Assign(assignRequest *VlanAssignRequest) (*Vla
 	return &flatVlanAssignment, resp, err
 }
 
+// Delete removes the VLAN assignment. Addresses an IPAM allocated for it stay
+// allocated until its next Sync, so delete through IPAM.Unassign instead.
 func (s *VlanAssignmentServiceOp) Delete(vlanAssignmentID string) (*Response, error) {
 	apiPath := path.Join(vlanAssignmentBasePath, vlanAssignmentID)
 
@@ -1,6 +1,9 @@
 package latitude
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 )
 
@@ -44,7 +47,9 @@ func createVirtualNetwork(t *testing.T, c *Client, projectID string) *VirtualNet
 		},
 	}
 	vn, _, err := c.VirtualNetworks.Create(&createRequest)
-	if err != nil {
+	// only the ID is needed, a network that couldn't be fetched back exists
+	var refetchErr *VirtualNetworkRefetchError
+	if err != nil && !errors.As(err, &refetchErr) {
 		t.Fatal(err)
 	}
 	return vn
@@ -83,7 +88,7 @@ func TestAccVlanAssignmentBasic(t *testing.T) {
 	defer deleteVlanAssignment(t, c, vlanID)
 
 	t.Run("Get and List Assignments", func(t *testing.T) {
-		vaTest, _, err := c.VlanAssignments.Get(vlanID)
+		vaTest, _, err := c.VlanAssignments.Get(vlanID, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -118,3 +123,50 @@ func TestAccVlanAssignmentBasic(t *testing.T) {
 		t.Fatalf("Vlan Assignment with id %s not found", vaTest.ID)
 	})
 }
+
+func TestVlanAssignmentGet(t *testing.T) {
+	var query string
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, r.URL.Path, "/virtual_networks/assignments", "Request path")
+		query = r.URL.Query().Get("filter[virtual_network_id]")
+		fmt.Fprint(w, `{"data":[{"id":"vnasg_1","type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","server":{"id":"sv_1"}}}]}`)
+	})
+
+	va, _, err := c.VlanAssignments.Get("vnasg_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, va.ServerID, "sv_1", "Assignment ServerID")
+	assertEqual(t, query, "", "Unfiltered listing")
+
+	if _, _, err := c.VlanAssignments.Get("vnasg_1", &VlanAssignmentFilter{VirtualNetworkID: "vlan_1"}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, query, "vlan_1", "Virtual network filter")
+
+	_, _, err = c.VlanAssignments.Get("vnasg_missing", nil)
+	var notFound *VlanAssignmentNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected a VlanAssignmentNotFoundError, got %v", err)
+	}
+	assertEqual(t, notFound.ID, "vnasg_missing", "Not found ID")
+}
+
+func TestVlanAssignmentListFiltered(t *testing.T) {
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assertEqual(t, q.Get("filter[virtual_network_id]"), "vlan_1", "Virtual network filter")
+		assertEqual(t, q.Get("filter[server]"), "sv_1", "Server filter")
+		fmt.Fprint(w, `{"data":[
+			{"id":"vnasg_1","type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","status":"connected","server":{"id":"sv_1"}}},
+			{"id":"vnasg_2","type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","status":"connecting","server":{"id":"sv_1"}}}
+		]}`)
+	})
+
+	vas, _, err := c.VlanAssignments.ListFiltered(VlanAssignmentFilter{VirtualNetworkID: "vlan_1", ServerID: "sv_1", Status: "connected"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(vas), 1, "Assignments")
+	assertEqual(t, vas[0].ID, "vnasg_1", "Assignment ID")
+}
@@ -1,6 +1,9 @@
 package latitude
 
-import "path"
+import (
+	"fmt"
+	"path"
+)
 
 const virtualNetworkBasePath = "/virtual_networks"
 
@@ -16,6 +19,22 @@ type VirtualNetworkServiceOp struct {
 	client requestDoer
 }
 
+// VirtualNetworkRefetchError is returned by Create and Update when the write
+// went through but the Get completing the result failed. Network holds the
+// network as returned by the write, the request must not be retried.
+type VirtualNetworkRefetchError struct {
+	Network *VirtualNetwork
+	Err     error
+}
+
+func (e *VirtualNetworkRefetchError) Error() string {
+	return fmt.Sprintf("virtual network %s was written but could not be fetched: %v", e.Network.ID, e.Err)
+}
+
+func (e *VirtualNetworkRefetchError) Unwrap() error {
+	return e.Err
+}
+
 type VirtualNetworkData struct {
 	ID         string                   `json:"id"`
 	Type       string                   `json:"type"`
@@ -56,6 +75,10 @@ type VirtualNetwork struct {
 	Facility         string     `json:"facility"`
 	AssignmentsCount int        `json:"assignments_count"`
 	Tags             []EmbedTag `json:"tags"`
+
+	// Name is only returned by Create and Update, the Get and List responses
+	// recorded in fixtures/TestAccVirtualNetworkBasic.yaml don't include it
+	Name string `json:"name"`
 }
 
 type VirtualNetworkListResponse struct {
@@ -99,9 +122,11 @@ type VirtualNetworkCreateData struct {
 }
 
 type VirtualNetworkCreateAttributes struct {
-	Description string `json:"description"`
-	Site        string `json:"site"`
-	Project     string `json:"project"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description"`
+	Site        string   `json:"site"`
+	Project     string   `json:"project"`
+	Tags        []string `json:"tags,omitempty"`
 }
 
 type VirtualNetworkUpdateRequest struct {
@@ -115,6 +140,7 @@ type VirtualNetworkUpdateData struct {
 }
 
 type VirtualNetworkUpdateAttributes struct {
+	Name        string   `json:"name,omitempty"`
 	Description string   `json:"description"`
 	Tags        []string `json:"tags,omitempty"`
 }
@@ -133,6 +159,7 @@ func NewFlatVirtualNetwork(vnd VirtualNetworkData) VirtualNetwork {
 		vnd.Attributes.Region.Site.Facility,
 		vnd.Attributes.AssignmentsCount,
 		vnd.Attributes.Tags,
+		"",
 	}
 }
 
@@ -141,6 +168,7 @@ func NewFlatCreatedVirtualNetwork(vnd VirtualNetworkPostData) VirtualNetwork {
 		ID:          vnd.ID,
 		Type:        vnd.Type,
 		Vid:         vnd.Attributes.Vid,
+		Name:        vnd.Attributes.Name,
 		Description: vnd.Attributes.Description,
 		SiteSlug:    vnd.Attributes.Site,
 		Tags:        vnd.Attributes.Tags,
@@ -190,7 +218,8 @@ func (s *VirtualNetworkServiceOp) Get(virtualNetworkID string, opts *GetOptions)
 	return &flatVirtualNetwork, resp, err
 }
 
-// Create creates a new virtual network
+// Create creates a new virtual network and returns it as Get would, along
+// with its name. A *VirtualNetworkRefetchError means the network was created.
 func (s *VirtualNetworkServiceOp) Create(createRequest *VirtualNetworkCreateRequest) (*VirtualNetwork, *Response, error) {
 	virtualNetwork := new(VirtualNetworkCreateResponse)
 
@@ -199,11 +228,11 @@ func (s *VirtualNetworkServiceOp) Create(createRequest *VirtualNetworkCreateRequ
 		return nil, resp, err
 	}
 
-	flatVirtualNetwork := NewFlatCreatedVirtualNetwork(virtualNetwork.Data)
-	return &flatVirtualNetwork, resp, err
+	return s.refetch(virtualNetwork.Data, resp)
 }
 
-// Update updates a virtual network
+// Update updates a virtual network and returns it as Get would, along with
+// its name. A *VirtualNetworkRefetchError means the update was applied.
 func (s *VirtualNetworkServiceOp) Update(virtualNetworkID string, updateRequest *VirtualNetworkUpdateRequest) (*VirtualNetwork, *Response, error) {
 	apiPath := path.Join(virtualNetworkBasePath, virtualNetworkID)
 	virtualNetwork := new(VirtualNetworkUpdateResponse)
@@ -213,8 +242,23 @@ func (s *VirtualNetworkServiceOp) Update(virtualNetworkID string, updateRequest
 		return nil, resp, err
 	}
 
-	flatVirtualNetwork := NewFlatCreatedVirtualNetwork(virtualNetwork.Data)
-	return &flatVirtualNetwork, resp, err
+	return s.refetch(virtualNetwork.Data, resp)
+}
+
+// refetch completes a create or update result with the region and
+// assignment details only returned by Get, keeping the name only returned by
+// the write. When the Get fails the partial network is returned in a
+// *VirtualNetworkRefetchError, along with the response of the write.
+func (s *VirtualNetworkServiceOp) refetch(vnd VirtualNetworkPostData, resp *Response) (*VirtualNetwork, *Response, error) {
+	partial := NewFlatCreatedVirtualNetwork(vnd)
+
+	virtualNetwork, _, err := s.Get(vnd.ID, nil)
+	if err != nil {
+		return &partial, resp, &VirtualNetworkRefetchError{Network: &partial, Err: err}
+	}
+
+	virtualNetwork.Name = partial.Name
+	return virtualNetwork, resp, nil
 }
 
 // Delete deletes a virtual network
@@ -1,6 +1,10 @@
 package latitude
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 )
 
@@ -38,6 +42,9 @@ func TestAccVirtualNetworkBasic(t *testing.T) {
 			t.Fatal(err)
 		}
 		vnID = vnNew.ID
+		if vnNew.Name == "" || vnNew.City == "" {
+			t.Fatalf("Created Virtual Network should have a name and a city, got %+v", vnNew)
+		}
 	})
 	defer deleteVirtualNetwork(t, c, vnID)
 
@@ -53,10 +60,11 @@ func TestAccVirtualNetworkBasic(t *testing.T) {
 			},
 		}
 
-		_, _, err := c.VirtualNetworks.Update(vnID, &updateRequest)
+		vnUpdated, _, err := c.VirtualNetworks.Update(vnID, &updateRequest)
 		if err != nil {
 			t.Fatal(err)
 		}
+		assertEqual(t, len(vnUpdated.Tags), 2, "Updated Virtual Network Tags")
 	})
 
 	t.Run("Get and List Virtual Networks", func(t *testing.T) {
@@ -96,3 +104,89 @@ func TestAccVirtualNetworkBasic(t *testing.T) {
 		t.Fatalf("Virtual Network with id %s not found", vnTest.ID)
 	})
 }
+
+func TestVirtualNetworkCreateAndUpdateRefetch(t *testing.T) {
+	const full = `{"data":{"id":"vlan_1","type":"virtual_networks","attributes":{"vid":2001,"description":"backend","region":{"city":"São Paulo","country":"Brazil","site":{"id":"loc_1","name":"São Paulo","slug":"SAO","facility":"Latitude.sh SP1"}},"assignments_count":3,"tags":[{"id":"tag_1","name":"web"}]}}}`
+
+	var bodies []map[string]interface{}
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /virtual_networks", "PATCH /virtual_networks/vlan_1":
+			var body struct {
+				Data struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			bodies = append(bodies, body.Data.Attributes)
+			fmt.Fprint(w, `{"data":{"id":"vlan_1","type":"virtual_networks","attributes":{"vid":2001,"name":"backend-net","description":"backend","site":"SAO","tags":[]}}}`)
+		case "GET /virtual_networks/vlan_1":
+			fmt.Fprint(w, full)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	vn, _, err := c.VirtualNetworks.Create(&VirtualNetworkCreateRequest{
+		Data: VirtualNetworkCreateData{
+			Type:       "virtual_network",
+			Attributes: VirtualNetworkCreateAttributes{Name: "backend-net", Description: "backend", Site: "SAO", Project: "proj_1", Tags: []string{"tag_1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, vn.Name, "backend-net", "Created Name")
+	assertEqual(t, vn.City, "São Paulo", "Created City")
+	assertEqual(t, vn.Country, "Brazil", "Created Country")
+	assertEqual(t, vn.SiteId, "loc_1", "Created SiteId")
+	assertEqual(t, vn.Facility, "Latitude.sh SP1", "Created Facility")
+	assertEqual(t, vn.AssignmentsCount, 3, "Created AssignmentsCount")
+	assertEqual(t, len(vn.Tags), 1, "Created Tags")
+
+	vn, _, err = c.VirtualNetworks.Update("vlan_1", &VirtualNetworkUpdateRequest{
+		Data: VirtualNetworkUpdateData{
+			ID:         "vlan_1",
+			Type:       "virtual_networks",
+			Attributes: VirtualNetworkUpdateAttributes{Name: "backend-net", Description: "backend", Tags: []string{"tag_1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, vn.SiteSlug, "SAO", "Updated SiteSlug")
+	assertEqual(t, vn.AssignmentsCount, 3, "Updated AssignmentsCount")
+
+	assertEqual(t, len(bodies), 2, "Write requests")
+	for _, attrs := range bodies {
+		assertEqual(t, attrs["name"], "backend-net", "Request name")
+		assertEqual(t, fmt.Sprint(attrs["tags"]), "[tag_1]", "Request tags")
+	}
+}
+
+func TestVirtualNetworkCreateRefetchError(t *testing.T) {
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /virtual_networks":
+			fmt.Fprint(w, `{"data":{"id":"vlan_1","type":"virtual_networks","attributes":{"vid":2001,"name":"backend-net","site":"SAO"}}}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	vn, resp, err := c.VirtualNetworks.Create(&VirtualNetworkCreateRequest{
+		Data: VirtualNetworkCreateData{Type: "virtual_network", Attributes: VirtualNetworkCreateAttributes{Site: "SAO", Project: "proj_1"}},
+	})
+	var refetchErr *VirtualNetworkRefetchError
+	if !errors.As(err, &refetchErr) {
+		t.Fatalf("Expected a VirtualNetworkRefetchError, got %v", err)
+	}
+	assertEqual(t, refetchErr.Network, vn, "Partial virtual network")
+	assertEqual(t, vn.ID, "vlan_1", "Partial ID")
+	assertEqual(t, vn.SiteSlug, "SAO", "Partial SiteSlug")
+	assertEqual(t, resp.StatusCode, http.StatusOK, "Create response status")
+	var errResp *ErrorResponse
+	assertEqual(t, errors.As(err, &errResp), true, "Wrapped Get error")
+}
@@ -0,0 +1,439 @@
+package latitude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIPAMNetworkNotFound is returned when no CIDR is registered for a
+	// virtual network
+	ErrIPAMNetworkNotFound = errors.New("no CIDR registered for the virtual network")
+
+	// ErrIPAMExhausted is returned when every address of a CIDR is allocated
+	ErrIPAMExhausted = errors.New("no free address left in the virtual network CIDR")
+)
+
+// IPAllocation is an address of a VLAN's CIDR allocated to a server.
+// AssignmentID is the VLAN assignment the address was allocated for, empty
+// until the server is assigned through IPAM.Assign or seen by IPAM.Sync.
+type IPAllocation struct {
+	VirtualNetworkID string     `json:"virtual_network_id"`
+	Vid              int        `json:"vid"`
+	Address          netip.Addr `json:"address"`
+	ServerID         string     `json:"server_id"`
+	AssignmentID     string     `json:"assignment_id,omitempty"`
+	AllocatedAt      time.Time  `json:"allocated_at"`
+}
+
+// IPAMNetwork is the CIDR the addresses of a VLAN are allocated from
+type IPAMNetwork struct {
+	VirtualNetworkID string         `json:"virtual_network_id"`
+	Vid              int            `json:"vid"`
+	CIDR             netip.Prefix   `json:"cidr"`
+	Allocations      []IPAllocation `json:"allocations"`
+}
+
+// IPAMState is what an IPAMStore persists, the networks keyed by virtual
+// network ID. VIDs are only unique within a site, so they can't be the key.
+type IPAMState struct {
+	Networks map[string]IPAMNetwork `json:"networks"`
+}
+
+func (s *IPAMState) clone() *IPAMState {
+	c := &IPAMState{Networks: make(map[string]IPAMNetwork, len(s.Networks))}
+	for id, n := range s.Networks {
+		n.Allocations = append([]IPAllocation(nil), n.Allocations...)
+		c.Networks[id] = n
+	}
+	return c
+}
+
+// IPAMStore persists the IPAM state. Save receives the complete state after
+// every change, and Load returns a nil state when nothing was saved yet.
+type IPAMStore interface {
+	Load() (*IPAMState, error)
+	Save(state *IPAMState) error
+}
+
+type ipamFileStore struct {
+	path string
+}
+
+// NewIPAMFileStore returns a store keeping the state as JSON in the file at
+// path. The file is replaced atomically on every save, but separate
+// processes sharing it overwrite each other's changes.
+func NewIPAMFileStore(path string) IPAMStore {
+	return &ipamFileStore{path: path}
+}
+
+func (s *ipamFileStore) Load() (*IPAMState, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := new(IPAMState)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("reading IPAM state %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+func (s *ipamFileStore) Save(state *IPAMState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+type ipamMemoryStore struct {
+	mu    sync.Mutex
+	state *IPAMState
+}
+
+// NewIPAMMemoryStore returns a store keeping the state in memory only
+func NewIPAMMemoryStore() IPAMStore {
+	return &ipamMemoryStore{}
+}
+
+func (ms *ipamMemoryStore) Load() (*IPAMState, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.state == nil {
+		return nil, nil
+	}
+	return ms.state.clone(), nil
+}
+
+func (ms *ipamMemoryStore) Save(state *IPAMState) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.state = state.clone()
+	return nil
+}
+
+// IPAM allocates private addresses to the servers assigned to virtual
+// networks. Every VLAN, identified by its virtual network ID, gets a CIDR
+// registered with AddNetwork, and each server gets one address of it.
+// Changes are saved to the store before they are visible.
+//
+// Assignments must be deleted through Unassign: VlanAssignments.Delete
+// leaves the address allocated until the next Sync.
+type IPAM struct {
+	client *Client
+	store  IPAMStore
+
+	mu    sync.Mutex
+	state *IPAMState
+}
+
+// NewIPAM returns an IPAM loaded from the store. The client is only used by
+// Assign, Unassign and Sync.
+func NewIPAM(c *Client, store IPAMStore) (*IPAM, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = &IPAMState{}
+	}
+	if state.Networks == nil {
+		state.Networks = map[string]IPAMNetwork{}
+	}
+	return &IPAM{client: c, store: store, state: state}, nil
+}
+
+// update applies fn to a copy of the state and keeps it once saved, so a
+// failed change or save leaves the state untouched. It must be called with
+// mu held.
+func (p *IPAM) update(fn func(state *IPAMState) error) error {
+	next := p.state.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	if err := p.store.Save(next); err != nil {
+		return err
+	}
+	p.state = next
+	return nil
+}
+
+// AddNetwork registers the CIDR addresses of the virtual network are
+// allocated from. The VID is only kept as an attribute of the allocations.
+// Registering the same CIDR again is a no-op, a different one is an error.
+func (p *IPAM) AddNetwork(virtualNetworkID string, vid int, cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	if prefix != prefix.Masked() {
+		return fmt.Errorf("CIDR %s has host bits set, use %s", cidr, prefix.Masked())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n, ok := p.state.Networks[virtualNetworkID]; ok {
+		if n.CIDR == prefix {
+			return nil
+		}
+		return fmt.Errorf("virtual network %s is already registered with CIDR %s", virtualNetworkID, n.CIDR)
+	}
+	return p.update(func(state *IPAMState) error {
+		state.Networks[virtualNetworkID] = IPAMNetwork{VirtualNetworkID: virtualNetworkID, Vid: vid, CIDR: prefix}
+		return nil
+	})
+}
+
+// RemoveNetwork unregisters the CIDR of the virtual network. It fails while
+// addresses are still allocated.
+func (p *IPAM) RemoveNetwork(virtualNetworkID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, ok := p.state.Networks[virtualNetworkID]
+	if !ok {
+		return nil
+	}
+	if len(n.Allocations) > 0 {
+		return fmt.Errorf("virtual network %s still has %d allocated addresses", virtualNetworkID, len(n.Allocations))
+	}
+	return p.update(func(state *IPAMState) error {
+		delete(state.Networks, virtualNetworkID)
+		return nil
+	})
+}
+
+// Networks returns the registered networks sorted by virtual network ID
+func (p *IPAM) Networks() []IPAMNetwork {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make([]IPAMNetwork, 0, len(p.state.Networks))
+	for _, n := range p.state.clone().Networks {
+		res = append(res, n)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].VirtualNetworkID < res[j].VirtualNetworkID })
+	return res
+}
+
+// Lookup returns the address allocated to the server on the virtual network
+func (p *IPAM) Lookup(virtualNetworkID, serverID string) (netip.Addr, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, a := range p.state.Networks[virtualNetworkID].Allocations {
+		if a.ServerID == serverID {
+			return a.Address, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// Allocate returns the address of the server on the virtual network,
+// allocating the lowest free one of the CIDR when it has none yet
+func (p *IPAM) Allocate(virtualNetworkID, serverID string) (netip.Addr, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addr, _, err := p.allocate(virtualNetworkID, serverID)
+	return addr, err
+}
+
+// allocate is Allocate, also reporting whether the address is new. It must
+// be called with mu held.
+func (p *IPAM) allocate(virtualNetworkID, serverID string) (addr netip.Addr, created bool, err error) {
+	n, ok := p.state.Networks[virtualNetworkID]
+	if !ok {
+		return addr, false, fmt.Errorf("virtual network %s: %w", virtualNetworkID, ErrIPAMNetworkNotFound)
+	}
+
+	taken := make(map[netip.Addr]bool, len(n.Allocations))
+	for _, a := range n.Allocations {
+		if a.ServerID == serverID {
+			return a.Address, false, nil
+		}
+		taken[a.Address] = true
+	}
+
+	first, last := usableRange(n.CIDR)
+	for a := first; a.IsValid() && a.Compare(last) <= 0; a = a.Next() {
+		if taken[a] {
+			continue
+		}
+		err = p.update(func(state *IPAMState) error {
+			n := state.Networks[virtualNetworkID]
+			n.Allocations = append(n.Allocations, IPAllocation{VirtualNetworkID: virtualNetworkID, Vid: n.Vid, Address: a, ServerID: serverID, AllocatedAt: time.Now().UTC()})
+			sort.Slice(n.Allocations, func(i, j int) bool { return n.Allocations[i].Address.Less(n.Allocations[j].Address) })
+			state.Networks[virtualNetworkID] = n
+			return nil
+		})
+		return a, err == nil, err
+	}
+	return addr, false, fmt.Errorf("virtual network %s (%s): %w", virtualNetworkID, n.CIDR, ErrIPAMExhausted)
+}
+
+// usableRange returns the first and last allocatable addresses of the
+// prefix, leaving out the network address and, for IPv4, the broadcast one
+func usableRange(prefix netip.Prefix) (netip.Addr, netip.Addr) {
+	first := prefix.Addr()
+	b := first.AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+
+	hostBits := first.BitLen() - prefix.Bits()
+	if first.Is4() && hostBits > 1 {
+		return first.Next(), last.Prev()
+	}
+	if first.Is6() && hostBits > 1 {
+		return first.Next(), last
+	}
+	return first, last
+}
+
+// Release frees the address of the server on the virtual network, if any
+func (p *IPAM) Release(virtualNetworkID, serverID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.state.Networks[virtualNetworkID]; !ok {
+		return fmt.Errorf("virtual network %s: %w", virtualNetworkID, ErrIPAMNetworkNotFound)
+	}
+	_, err := p.release(func(a IPAllocation) bool {
+		return a.VirtualNetworkID == virtualNetworkID && a.ServerID == serverID
+	})
+	return err
+}
+
+// release frees the allocations matching fn and returns them. It must be
+// called with mu held.
+func (p *IPAM) release(fn func(a IPAllocation) bool) ([]IPAllocation, error) {
+	var released []IPAllocation
+	err := p.update(func(state *IPAMState) error {
+		for id, n := range state.Networks {
+			kept := n.Allocations[:0]
+			for _, a := range n.Allocations {
+				if fn(a) {
+					released = append(released, a)
+				} else {
+					kept = append(kept, a)
+				}
+			}
+			n.Allocations = kept
+			state.Networks[id] = n
+		}
+		return nil
+	})
+	if err != nil || len(released) == 0 {
+		return nil, err
+	}
+	return released, nil
+}
+
+// Assign assigns the server to the virtual network and allocates its
+// address. The address is allocated first, so a full CIDR fails before the
+// assignment is created, and it is released again when the assignment fails.
+func (p *IPAM) Assign(assignRequest *VlanAssignRequest) (*VlanAssignment, netip.Addr, *Response, error) {
+	attrs := assignRequest.Data.Attributes
+
+	p.mu.Lock()
+	addr, created, err := p.allocate(attrs.VirtualNetworkID, attrs.ServerID)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, addr, nil, err
+	}
+
+	assignment, resp, err := p.client.VlanAssignments.Assign(assignRequest)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		if created {
+			_, _ = p.release(func(a IPAllocation) bool {
+				return a.VirtualNetworkID == attrs.VirtualNetworkID && a.Address == addr
+			})
+		}
+		return nil, netip.Addr{}, resp, err
+	}
+
+	err = p.update(func(state *IPAMState) error {
+		n := state.Networks[attrs.VirtualNetworkID]
+		for i := range n.Allocations {
+			if n.Allocations[i].Address == addr {
+				n.Allocations[i].AssignmentID = assignment.ID
+			}
+		}
+		return nil
+	})
+	return assignment, addr, resp, err
+}
+
+// Unassign deletes the VLAN assignment and releases the address allocated
+// for it. An assignment already deleted from the API is only released.
+func (p *IPAM) Unassign(vlanAssignmentID string) (*Response, error) {
+	resp, err := p.client.VlanAssignments.Delete(vlanAssignmentID)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return resp, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.release(func(a IPAllocation) bool { return a.AssignmentID == vlanAssignmentID })
+	return resp, err
+}
+
+// Sync reconciles the allocations with the VLAN assignments of the API. It
+// releases the addresses whose assignment was deleted, and links the
+// allocations made with Allocate to the assignment of their server once it
+// exists. The released allocations are returned.
+func (p *IPAM) Sync() ([]IPAllocation, *Response, error) {
+	assignments, resp, err := p.client.VlanAssignments.List(nil)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	type member struct {
+		virtualNetworkID string
+		serverID         string
+	}
+	ids := map[string]bool{}
+	members := map[member]string{}
+	for _, va := range assignments {
+		ids[va.ID] = true
+		members[member{va.VirtualNetworkID, va.ServerID}] = va.ID
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err = p.update(func(state *IPAMState) error {
+		for _, n := range state.Networks {
+			for i, a := range n.Allocations {
+				if a.AssignmentID == "" {
+					n.Allocations[i].AssignmentID = members[member{a.VirtualNetworkID, a.ServerID}]
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	released, err := p.release(func(a IPAllocation) bool { return a.AssignmentID != "" && !ids[a.AssignmentID] })
+	return released, resp, err
+}
@@ -0,0 +1,214 @@
+package latitude
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPAMAllocate(t *testing.T) {
+	ipam, err := NewIPAM(nil, NewIPAMMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ipam.Allocate("vlan_1", "sv_1"); !errors.Is(err, ErrIPAMNetworkNotFound) {
+		t.Fatalf("expected ErrIPAMNetworkNotFound, got %v", err)
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.0.1/30"); err == nil {
+		t.Fatal("expected an error for a CIDR with host bits set")
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.0.0/30"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.0.0/30"); err != nil {
+		t.Fatalf("registering the same CIDR again should be a no-op, got %v", err)
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.1.0/24"); err == nil {
+		t.Fatal("expected an error registering a different CIDR")
+	}
+
+	a1, err := ipam.Allocate("vlan_1", "sv_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, a1.String(), "10.0.0.1", "First address")
+
+	again, err := ipam.Allocate("vlan_1", "sv_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, again, a1, "Address allocated again")
+
+	a2, err := ipam.Allocate("vlan_1", "sv_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, a2.String(), "10.0.0.2", "Second address")
+
+	if _, err := ipam.Allocate("vlan_1", "sv_3"); !errors.Is(err, ErrIPAMExhausted) {
+		t.Fatalf("expected ErrIPAMExhausted, got %v", err)
+	}
+
+	if err := ipam.RemoveNetwork("vlan_1"); err == nil {
+		t.Fatal("expected an error removing a network with allocations")
+	}
+	if err := ipam.Release("vlan_1", "sv_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ipam.Lookup("vlan_1", "sv_1"); ok {
+		t.Fatal("sv_1 should have no address after release")
+	}
+
+	a3, err := ipam.Allocate("vlan_1", "sv_3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, a3, a1, "Released address reused")
+}
+
+func TestIPAMUsableRange(t *testing.T) {
+	for cidr, want := range map[string]string{
+		"10.0.0.0/24":    "10.0.0.1-10.0.0.254",
+		"10.0.0.0/31":    "10.0.0.0-10.0.0.1",
+		"10.0.0.7/32":    "10.0.0.7-10.0.0.7",
+		"fd00::/120":     "fd00::1-fd00::ff",
+		"172.16.0.0/12":  "172.16.0.1-172.31.255.254",
+		"192.168.4.0/22": "192.168.4.1-192.168.7.254",
+	} {
+		first, last := usableRange(netip.MustParsePrefix(cidr))
+		assertEqual(t, first.String()+"-"+last.String(), want, "Usable range of "+cidr)
+	}
+}
+
+func TestIPAMFileStore(t *testing.T) {
+	store := NewIPAMFileStore(filepath.Join(t.TempDir(), "ipam.json"))
+
+	ipam, err := NewIPAM(nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AddNetwork("vlan_2", 2002, "fd00::/64"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.Allocate("vlan_1", "sv_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.Allocate("vlan_2", "sv_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewIPAM(nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	networks := reloaded.Networks()
+	assertEqual(t, len(networks), 2, "Reloaded networks")
+	assertEqual(t, networks[0].Vid, 2001, "First network VID")
+	assertEqual(t, networks[1].CIDR.String(), "fd00::/64", "Second network CIDR")
+
+	addr, ok := reloaded.Lookup("vlan_2", "sv_1")
+	if !ok {
+		t.Fatal("expected the reloaded allocation")
+	}
+	assertEqual(t, addr.String(), "fd00::1", "Reloaded address")
+}
+
+func TestIPAMAssignments(t *testing.T) {
+	failAssign := false
+	assignments := map[string]string{}
+	c := setupMock(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /virtual_networks/assignments":
+			if failAssign {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"errors":[{"code":"SERVER_BUSY","status":"422","title":"Server busy"}]}`)
+				return
+			}
+			id := fmt.Sprintf("vnasg_%d", len(assignments)+1)
+			assignments[id] = "sv_1"
+			fmt.Fprintf(w, `{"data":{"id":%q,"type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","vid":2001,"server_id":"sv_1"}}}`, id)
+		case "GET /virtual_networks/assignments":
+			// only sv_2 is still assigned, sv_1's assignment was deleted elsewhere
+			fmt.Fprint(w, `{"data":[{"id":"vnasg_9","type":"virtual_network_assignment","attributes":{"virtual_network_id":"vlan_1","vid":2001,"server":{"id":"sv_2"}}}]}`)
+		case "DELETE /virtual_networks/assignments/vnasg_1":
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE /virtual_networks/assignments/vnasg_gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	ipam, err := NewIPAM(c, NewIPAMMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AddNetwork("vlan_1", 2001, "10.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &VlanAssignRequest{Data: VlanAssignData{Type: "virtual_network_assignment", Attributes: VlanAssignAttributes{ServerID: "sv_1", VirtualNetworkID: "vlan_1"}}}
+
+	failAssign = true
+	if _, _, _, err := ipam.Assign(req); err == nil {
+		t.Fatal("expected the assign error")
+	}
+	if _, ok := ipam.Lookup("vlan_1", "sv_1"); ok {
+		t.Fatal("a failed assign should release the address")
+	}
+
+	failAssign = false
+	assignment, addr, _, err := ipam.Assign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, assignment.ID, "vnasg_1", "Assignment ID")
+	assertEqual(t, addr.String(), "10.0.0.1", "Assigned address")
+	assertEqual(t, ipam.Networks()[0].Allocations[0].AssignmentID, "vnasg_1", "Allocation assignment")
+
+	if _, err := ipam.Unassign("vnasg_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ipam.Lookup("vlan_1", "sv_1"); ok {
+		t.Fatal("unassign should release the address")
+	}
+
+	// sv_1 was assigned and then unassigned outside of the IPAM, sv_2 was
+	// allocated before being assigned
+	if _, _, _, err := ipam.Assign(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.Allocate("vlan_1", "sv_2"); err != nil {
+		t.Fatal(err)
+	}
+	// vlan_2 reuses the VID in another site, its sv_2 allocation must not be
+	// linked to the vlan_1 assignment
+	if err := ipam.AddNetwork("vlan_2", 2001, "10.1.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.Allocate("vlan_2", "sv_2"); err != nil {
+		t.Fatal(err)
+	}
+	released, _, err := ipam.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, len(released), 1, "Released allocations")
+	assertEqual(t, released[0].ServerID, "sv_1", "Released server")
+
+	allocations := ipam.Networks()[0].Allocations
+	assertEqual(t, len(allocations), 1, "Remaining allocations")
+	assertEqual(t, allocations[0].AssignmentID, "vnasg_9", "Linked assignment")
+	assertEqual(t, ipam.Networks()[1].Allocations[0].AssignmentID, "", "Same VID in another site")
+
+	if _, err := ipam.Unassign("vnasg_gone"); err != nil {
+		t.Fatalf("unassigning a deleted assignment should only release, got %v", err)
+	}
+}